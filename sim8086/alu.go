@@ -0,0 +1,255 @@
+package main
+
+func widthMask(wide bool) uint32 {
+	if wide {
+		return 0xffff
+	}
+
+	return 0xff
+}
+
+func signBit(wide bool) uint32 {
+	if wide {
+		return 0x8000
+	}
+
+	return 0x80
+}
+
+func Add(left, right int16, carry bool, wide bool, registers Registers) int16 {
+	mask := widthMask(wide)
+	l := uint32(uint16(left)) & mask
+	r := uint32(uint16(right)) & mask
+
+	result := l + r + uint32(BoolToInt(carry))
+
+	SetFlag(registers, RF_carry, result > mask)
+	SetFlag(registers, RF_aux, (l^r^result)&0x10 != 0)
+	SetFlag(registers, RF_overflow, (l^result)&(r^result)&signBit(wide) != 0)
+
+	value := int16(result & mask)
+	UpdateFlagsRegister(value, wide, registers)
+
+	return value
+}
+
+func Sub(left, right int16, borrow bool, wide bool, registers Registers) int16 {
+	mask := widthMask(wide)
+	l := uint32(uint16(left)) & mask
+	r := uint32(uint16(right)) & mask
+	b := uint32(BoolToInt(borrow))
+
+	result := (l - r - b) & mask
+
+	SetFlag(registers, RF_carry, l < r+b)
+	SetFlag(registers, RF_aux, (l^r^result)&0x10 != 0)
+	SetFlag(registers, RF_overflow, (l^r)&(l^result)&signBit(wide) != 0)
+
+	value := int16(result)
+	UpdateFlagsRegister(value, wide, registers)
+
+	return value
+}
+
+// Multiply stores the product of the accumulator and operand in ax (byte form)
+// or dx:ax (word form). Carry and overflow are set when the upper half is
+// significant, the other flags are left as they were.
+func Multiply(operand int16, signed bool, wide bool, registers Registers) {
+	var upperUsed bool
+
+	if wide {
+		var product uint32
+		if signed {
+			result := int32(registers[RI_a]) * int32(operand)
+			upperUsed = result != int32(int16(result))
+			product = uint32(result)
+		} else {
+			product = uint32(uint16(registers[RI_a])) * uint32(uint16(operand))
+			upperUsed = product > 0xffff
+		}
+
+		registers[RI_a] = int16(product)
+		registers[RI_d] = int16(product >> 16)
+	} else {
+		var product uint16
+		if signed {
+			result := int16(int8(registers[RI_a])) * int16(int8(operand))
+			upperUsed = result != int16(int8(result))
+			product = uint16(result)
+		} else {
+			product = uint16(uint8(registers[RI_a])) * uint16(uint8(operand))
+			upperUsed = product > 0xff
+		}
+
+		registers[RI_a] = int16(product)
+	}
+
+	SetFlag(registers, RF_carry, upperUsed)
+	SetFlag(registers, RF_overflow, upperUsed)
+
+	TraceFlags(registers)
+}
+
+// Divide divides ax (byte form) or dx:ax (word form) by the operand, leaving
+// quotient and remainder in al:ah or ax:dx. It reports false when the divisor
+// is zero or the quotient doesn't fit, which the CPU turns into interrupt 0.
+func Divide(operand int16, signed bool, wide bool, registers Registers) bool {
+	if wide {
+		if signed {
+			dividend := int32(uint32(uint16(registers[RI_d]))<<16 | uint32(uint16(registers[RI_a])))
+			divisor := int32(operand)
+			if divisor == 0 {
+				return false
+			}
+
+			// the 8086 doesn't accept -0x8000 as a quotient
+			quotient := dividend / divisor
+			if quotient > 0x7fff || quotient < -0x7fff {
+				return false
+			}
+
+			registers[RI_a] = int16(quotient)
+			registers[RI_d] = int16(dividend % divisor)
+		} else {
+			dividend := uint32(uint16(registers[RI_d]))<<16 | uint32(uint16(registers[RI_a]))
+			divisor := uint32(uint16(operand))
+			if divisor == 0 {
+				return false
+			}
+
+			quotient := dividend / divisor
+			if quotient > 0xffff {
+				return false
+			}
+
+			registers[RI_a] = int16(quotient)
+			registers[RI_d] = int16(dividend % divisor)
+		}
+
+		return true
+	}
+
+	var quotient, remainder uint8
+	if signed {
+		dividend := int16(registers[RI_a])
+		divisor := int16(int8(operand))
+		if divisor == 0 {
+			return false
+		}
+
+		result := dividend / divisor
+		if result > 0x7f || result < -0x7f {
+			return false
+		}
+
+		quotient = uint8(result)
+		remainder = uint8(dividend % divisor)
+	} else {
+		dividend := uint16(registers[RI_a])
+		divisor := uint16(uint8(operand))
+		if divisor == 0 {
+			return false
+		}
+
+		result := dividend / divisor
+		if result > 0xff {
+			return false
+		}
+
+		quotient = uint8(result)
+		remainder = uint8(dividend % divisor)
+	}
+
+	registers[RI_a] = int16(uint16(remainder)<<8 | uint16(quotient))
+
+	return true
+}
+
+// Logic sets flags for the result of and, or, xor and test, which always
+// clear carry and overflow. Aux carry is undefined and left alone.
+func Logic(value int16, wide bool, registers Registers) int16 {
+	value = int16(uint32(uint16(value)) & widthMask(wide))
+
+	SetFlag(registers, RF_carry, false)
+	SetFlag(registers, RF_overflow, false)
+	UpdateFlagsRegister(value, wide, registers)
+
+	return value
+}
+
+// Shift applies a shift or rotate one bit at a time, the way the 8086 does.
+// Carry holds the last bit shifted out and overflow reflects the final step.
+// Rotates leave zero and sign alone; a zero count changes nothing.
+func Shift(op string, value int16, count int, wide bool, registers Registers) int16 {
+	if count == 0 {
+		return value
+	}
+
+	mask := widthMask(wide)
+	sign := signBit(wide)
+
+	v := uint32(uint16(value)) & mask
+	carry := GetFlag(registers, RF_carry)
+	overflow := GetFlag(registers, RF_overflow)
+
+	for range count {
+		switch op {
+		case "shl":
+			carry = v&sign != 0
+			v = (v << 1) & mask
+			overflow = (v&sign != 0) != carry
+
+		case "shr":
+			overflow = v&sign != 0
+			carry = v&1 != 0
+			v >>= 1
+
+		case "sar":
+			overflow = false
+			carry = v&1 != 0
+			v = v>>1 | v&sign
+
+		case "rol":
+			carry = v&sign != 0
+			v = (v<<1)&mask | uint32(BoolToInt(carry))
+			overflow = (v&sign != 0) != carry
+
+		case "ror":
+			carry = v&1 != 0
+			v >>= 1
+			if carry {
+				v |= sign
+			}
+			overflow = (v&sign != 0) != (v&(sign>>1) != 0)
+
+		case "rcl":
+			carryIn := uint32(BoolToInt(carry))
+			carry = v&sign != 0
+			v = (v<<1)&mask | carryIn
+			overflow = (v&sign != 0) != carry
+
+		case "rcr":
+			overflow = (v&sign != 0) != carry
+			carryIn := carry
+			carry = v&1 != 0
+			v >>= 1
+			if carryIn {
+				v |= sign
+			}
+		}
+	}
+
+	SetFlag(registers, RF_carry, carry)
+	SetFlag(registers, RF_overflow, overflow)
+
+	result := int16(v)
+
+	switch op {
+	case "shl", "shr", "sar":
+		UpdateFlagsRegister(result, wide, registers)
+	default:
+		TraceFlags(registers)
+	}
+
+	return result
+}
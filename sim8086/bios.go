@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Console receives teletype output, ConsoleInput supplies the keyboard. Both
+// default to the host terminal, the console on stderr to keep it out of the
+// trace; tests can script the keyboard from a file.
+var Console io.Writer = os.Stderr
+var ConsoleInput = NewKeyboard(os.Stdin, false)
+
+// BIOS data area fields the video and keyboard services keep up to date
+const (
+	BiosDataSegment = 0x40
+	bdaVideoMode    = 0x49
+	bdaColumns      = 0x4a
+	bdaCursor       = 0x50 // column and row for each of 8 pages
+	bdaActivePage   = 0x62
+	bdaTimerTicks   = 0x6c
+)
+
+// the timer interrupt runs code placed here before its handler
+const biosTimerEntry = 0x100
+
+const GraphicsSegment = 0xa000
+
+const (
+	TextSegment = 0xb800
+	TextColumns = 80
+	TextRows    = 25
+)
+
+// InstallBios sets up the vector table, the video and keyboard services, an
+// 80x25 colour text screen, and the interrupt controller and timer the way
+// the PC BIOS leaves them: hardware interrupts at vector 8 and up, and a
+// timer tick 18.2 times a second.
+func InstallBios(memory Memory) {
+	InstallInterruptVectors(memory)
+
+	InterruptHandlers[0x08] = biosTimer
+	InterruptHandlers[0x10] = biosVideo
+	InterruptHandlers[0x16] = biosKeyboard
+
+	// the tick calls the user timer hook before the handler counts it:
+	// int 1ch; jmp f000:0008
+	entry := []byte{0xcd, 0x1c, 0xea, 0x08, 0x00, 0x00, 0xf0}
+	for i, b := range entry {
+		memory.Store(BiosSegment, biosTimerEntry+uint16(i), uint16(b), false)
+	}
+	memory.Store(0, 0x08*4, biosTimerEntry, true)
+
+	// ICW1 edge triggered, single, ICW4 needed; ICW2 base 8; ICW4 8086 mode
+	Ports.Out(0x20, 0x13, false)
+	Ports.Out(0x21, 0x08, false)
+	Ports.Out(0x21, 0x01, false)
+
+	// channel 0 square wave, lo/hi reload of 0 counts 65536
+	Ports.Out(0x43, 0x36, false)
+	Ports.Out(0x40, 0, false)
+	Ports.Out(0x40, 0, false)
+
+	setVideoMode(3, memory)
+}
+
+// int 08h - timer tick, counts ticks in the data area and ends the interrupt
+func biosTimer(registers Registers, memory Memory) error {
+	low := memory.Load(BiosDataSegment, bdaTimerTicks, true) + 1
+	memory.Store(BiosDataSegment, bdaTimerTicks, low, true)
+	if low == 0 {
+		high := memory.Load(BiosDataSegment, bdaTimerTicks+2, true)
+		memory.Store(BiosDataSegment, bdaTimerTicks+2, high+1, true)
+	}
+
+	Ports.Out(0x20, 0x20, false) // non-specific EOI
+
+	return nil
+}
+
+// int 10h - video services, function in ah
+func biosVideo(registers Registers, memory Memory) error {
+	a := uint16(registers[RI_a])
+	b := uint16(registers[RI_b])
+	d := uint16(registers[RI_d])
+
+	switch ah := byte(a >> 8); ah {
+	case 0x00: // set video mode al
+		setVideoMode(byte(a)&0x7f, memory)
+
+	case 0x02: // set cursor of page bh to row dh, column dl
+		page := byte(b>>8) & 7
+		setCursor(page, byte(d>>8), byte(d), memory)
+
+		if page == activePage(memory) {
+			fmt.Fprintf(Console, "\x1b[%d;%dH", d>>8+1, d&0xff+1)
+		}
+
+	case 0x03: // get cursor of page bh into dh:dl, with the shape in cx
+		row, column := cursor(byte(b>>8)&7, memory)
+		registers[RI_d] = int16(uint16(row)<<8 | uint16(column))
+		registers[RI_c] = 0x0607
+
+	case 0x0b: // bh 0 sets the background from bl, bh 1 the 320x200 palette
+		if byte(b>>8) == 0 {
+			Cga.Value = Cga.Value&0xf0 | byte(b)&0xf
+		} else {
+			Cga.Value = Cga.Value&^0x20 | byte(b)&1<<5
+		}
+
+	case 0x0c: // plot pixel al at column cx, row dx; bit 7 of al xors it in the CGA modes
+		x, y := uint16(registers[RI_c]), d
+		if isMode13h(memory) && x < 320 && y < 200 {
+			memory.Store(GraphicsSegment, y*320+x, a&0xff, false)
+		}
+
+		if width, bits, ok := cgaMode(memory); ok && int(x) < width && y < 200 {
+			offset, shift := cgaPixel(int(x), int(y), width, bits)
+			mask := uint16(1)<<bits - 1
+			value := (a & mask) << shift
+			old := memory.Load(TextSegment, offset, false)
+			if a&0x80 == 0 {
+				old &^= mask << shift
+			}
+			memory.Store(TextSegment, offset, old^value, false)
+		}
+
+	case 0x0d: // read the pixel at column cx, row dx into al
+		x, y := uint16(registers[RI_c]), d
+		if isMode13h(memory) && x < 320 && y < 200 {
+			setLow(registers, RI_a, byte(memory.Load(GraphicsSegment, y*320+x, false)))
+		}
+
+		if width, bits, ok := cgaMode(memory); ok && int(x) < width && y < 200 {
+			offset, shift := cgaPixel(int(x), int(y), width, bits)
+			setLow(registers, RI_a, byte(memory.Load(TextSegment, offset, false)>>shift)&(1<<bits-1))
+		}
+
+	case 0x0e: // teletype output of al
+		Teletype([]byte{byte(a)}, memory)
+
+	case 0x0f: // get video mode into al, columns into ah and page into bh
+		mode := memory.Load(BiosDataSegment, bdaVideoMode, false)
+		columns := memory.Load(BiosDataSegment, bdaColumns, false)
+		registers[RI_a] = int16(columns<<8 | mode)
+		setHigh(registers, RI_b, activePage(memory))
+
+	default:
+		return fmt.Errorf("unsupported video function %02xh", ah)
+	}
+
+	return nil
+}
+
+// int 16h - keyboard services, function in ah
+func biosKeyboard(registers Registers, memory Memory) error {
+	switch ah := byte(uint16(registers[RI_a]) >> 8); ah {
+	case 0x00, 0x10: // wait for a key, ascii in al and scan code in ah
+		char, ok := ConsoleInput.Read()
+		if !ok {
+			return fmt.Errorf("keyboard input exhausted")
+		}
+
+		registers[RI_a] = int16(KeyCode(char))
+
+	case 0x01, 0x11: // peek at the next key without waiting, zero set when there is none
+		next, ok := ConsoleInput.Peek()
+		if ok {
+			registers[RI_a] = int16(KeyCode(next))
+		}
+
+		SetReturnFlag(RF_zero, !ok, registers, memory)
+
+	case 0x02, 0x12: // shift flags, never any held down
+		setLow(registers, RI_a, 0)
+
+	default:
+		return fmt.Errorf("unsupported keyboard function %02xh", ah)
+	}
+
+	return nil
+}
+
+// Teletype writes characters the way int 10h ah=0eh does: to the console and
+// to the text screen at the cursor, handling bell, backspace, carriage return
+// and line feed, wrapping at the right edge and scrolling at the bottom.
+func Teletype(text []byte, memory Memory) {
+	Console.Write(text)
+
+	page := activePage(memory)
+
+	for _, char := range text {
+		row, column := cursor(page, memory)
+
+		switch char {
+		case '\a':
+		case '\b':
+			if column > 0 {
+				column--
+			}
+		case '\r':
+			column = 0
+		case '\n':
+			row++
+		default:
+			if isTextMode(memory) {
+				offset := (uint16(row)*TextColumns + uint16(column)) * 2
+				memory.Store(TextSegment, offset, uint16(char), false)
+			}
+
+			column++
+			if column == TextColumns {
+				column = 0
+				row++
+			}
+		}
+
+		if row == TextRows {
+			row--
+			scrollText(memory)
+		}
+
+		setCursor(page, row, column, memory)
+	}
+}
+
+// scrollText moves the screen up a line and blanks the bottom one.
+func scrollText(memory Memory) {
+	if !isTextMode(memory) {
+		return
+	}
+
+	const line = TextColumns * 2
+
+	for offset := uint16(0); offset < line*(TextRows-1); offset++ {
+		memory.Store(TextSegment, offset, memory.Load(TextSegment, offset+line, false), false)
+	}
+
+	for offset := uint16(line * (TextRows - 1)); offset < line*TextRows; offset += 2 {
+		memory.Store(TextSegment, offset, 0x0720, true)
+	}
+}
+
+// setVideoMode records the mode, homes the cursors and clears the screen.
+func setVideoMode(mode byte, memory Memory) {
+	memory.Store(BiosDataSegment, bdaVideoMode, uint16(mode), false)
+	memory.Store(BiosDataSegment, bdaColumns, TextColumns, false)
+	memory.Store(BiosDataSegment, bdaActivePage, 0, false)
+
+	for page := range byte(8) {
+		setCursor(page, 0, 0, memory)
+	}
+
+	if isTextMode(memory) {
+		for offset := uint16(0); offset < TextColumns*TextRows*2; offset += 2 {
+			memory.Store(TextSegment, offset, 0x0720, true) // grey on black space
+		}
+	}
+
+	if isMode13h(memory) {
+		for offset := uint16(0); offset < 320*200; offset++ {
+			memory.Store(GraphicsSegment, offset, 0, false)
+		}
+	}
+
+	// both banks of scanlines, and the colours the BIOS picks
+	if _, bits, ok := cgaMode(memory); ok {
+		for offset := uint16(0); offset < 0x4000; offset++ {
+			memory.Store(TextSegment, offset, 0, false)
+		}
+
+		Cga.Value = 0x30
+		if bits == 1 {
+			Cga.Value = 0x3f
+		}
+	}
+}
+
+func isMode13h(memory Memory) bool {
+	return memory.Load(BiosDataSegment, bdaVideoMode, false) == 0x13
+}
+
+// cgaMode gives the width and bits a pixel of the CGA graphics mode set, if
+// one is: 04h and 05h are 320x200 in four colours, 06h 640x200 in two.
+func cgaMode(memory Memory) (width, bits int, ok bool) {
+	switch memory.Load(BiosDataSegment, bdaVideoMode, false) {
+	case 4, 5:
+		return 320, 2, true
+	case 6:
+		return 640, 1, true
+	}
+
+	return 0, 0, false
+}
+
+func isTextMode(memory Memory) bool {
+	switch memory.Load(BiosDataSegment, bdaVideoMode, false) {
+	case 2, 3:
+		return true
+	}
+
+	return false
+}
+
+func activePage(memory Memory) byte {
+	return byte(memory.Load(BiosDataSegment, bdaActivePage, false))
+}
+
+func cursor(page byte, memory Memory) (row, column byte) {
+	position := memory.Load(BiosDataSegment, bdaCursor+uint16(page)*2, true)
+	return byte(position >> 8), byte(position)
+}
+
+func setCursor(page, row, column byte, memory Memory) {
+	memory.Store(BiosDataSegment, bdaCursor+uint16(page)*2, uint16(row)<<8|uint16(column), true)
+}
+
+// KeyCode pairs a character with the scan code of its key on a US keyboard,
+// the form int 16h returns keys in.
+func KeyCode(char byte) uint16 {
+	rows := []struct {
+		scan           byte
+		plain, shifted string
+	}{
+		{0x02, "1234567890-=", "!@#$%^&*()_+"},
+		{0x10, "qwertyuiop[]", "QWERTYUIOP{}"},
+		{0x1e, "asdfghjkl;'`", "ASDFGHJKL:\"~"},
+		{0x2b, "\\zxcvbnm,./", "|ZXCVBNM<>?"},
+	}
+
+	for _, row := range rows {
+		for i := range len(row.plain) {
+			if row.plain[i] == char || row.shifted[i] == char {
+				return uint16(row.scan+byte(i))<<8 | uint16(char)
+			}
+		}
+	}
+
+	var scan byte
+	switch char {
+	case 0x1b:
+		scan = 0x01
+	case '\b':
+		scan = 0x0e
+	case '\t':
+		scan = 0x0f
+	case '\r', '\n':
+		// a line of scripted input presses enter
+		scan, char = 0x1c, '\r'
+	case ' ':
+		scan = 0x39
+	}
+
+	return uint16(scan)<<8 | uint16(char)
+}
+
+func setLow(registers Registers, index RegisterIndex, value byte) {
+	registers[index] = registers[index]&^0xff | int16(value)
+}
+
+func setHigh(registers Registers, index RegisterIndex, value byte) {
+	registers[index] = int16(uint16(registers[index])&0xff | uint16(value)<<8)
+}
@@ -0,0 +1,55 @@
+package main
+
+// CgaColorSelect is the CGA colour select register at 3d9h. In the 320x200
+// four colour mode the low four bits are the background, bit 4 brightens
+// the other three colours and bit 5 picks cyan, magenta and white over
+// green, red and brown. In the 640x200 two colour mode the low four bits
+// are the foreground instead. Colours are indices into the first 16 entries
+// of the VGA palette, which hold the CGA colours.
+type CgaColorSelect struct {
+	Value byte
+}
+
+// Cga starts the way the BIOS leaves it after setting mode 04h.
+var Cga = &CgaColorSelect{Value: 0x30}
+
+// In floats high, the register is write only.
+func (cga *CgaColorSelect) In(port uint16) byte {
+	return 0xff
+}
+
+func (cga *CgaColorSelect) Out(port uint16, value byte) {
+	cga.Value = value
+}
+
+// Colors gives the palette index of each of the four 320x200 pixel values.
+func (cga *CgaColorSelect) Colors() [4]byte {
+	colors := [4]byte{cga.Value & 0xf, 2, 4, 6}
+	if cga.Value&0x20 != 0 {
+		colors = [4]byte{cga.Value & 0xf, 3, 5, 7}
+	}
+
+	if cga.Value&0x10 != 0 {
+		for i := 1; i < 4; i++ {
+			colors[i] += 8
+		}
+	}
+
+	return colors
+}
+
+// Foreground is the palette index of set pixels at 640x200.
+func (cga *CgaColorSelect) Foreground() byte {
+	return cga.Value & 0xf
+}
+
+// cgaPixel finds pixel x, y of a CGA graphics screen width pixels wide with
+// bits a pixel. Even scanlines are in the first 8K and odd ones in the
+// second, packed from the high bits of each byte down.
+func cgaPixel(x, y, width, bits int) (offset uint16, shift int) {
+	perByte := 8 / bits
+	offset = uint16((y&1)*0x2000 + (y>>1)*width/perByte + x/perByte)
+	shift = 8 - bits*(x%perByte+1)
+
+	return offset, shift
+}
@@ -29,6 +29,12 @@ func EstimateCycles(op Operand) (cycles int) {
 }
 
 func (inst Instruction) EstimateCycles() (cycles int) {
+	defer func() {
+		if inst.Segment != "" {
+			cycles += 2
+		}
+	}()
+
 	switch inst.Op {
 	case "mov":
 		switch left := inst.Operands[0].(type) {
@@ -64,7 +70,7 @@ func (inst Instruction) EstimateCycles() (cycles int) {
 			}
 		}
 
-	case "add", "sub":
+	case "add", "sub", "adc", "sbb", "and", "or", "xor":
 		switch left := inst.Operands[0].(type) {
 		case OperandRegister:
 			switch right := inst.Operands[1].(type) {
@@ -91,6 +97,157 @@ func (inst Instruction) EstimateCycles() (cycles int) {
 
 		}
 
+	case "movs", "cmps", "scas", "lods", "stos":
+		// single / repeated: 9 to set up plus cost per repetition
+		costs := map[string][2]int{
+			"movs": {18, 17},
+			"cmps": {22, 22},
+			"scas": {15, 15},
+			"lods": {12, 13},
+			"stos": {11, 10},
+		}[inst.Op]
+
+		if inst.Rep == "" {
+			cycles = costs[0]
+			break
+		}
+
+		cycles = 9 + costs[1]*inst.Repetitions
+
+	case "test":
+		switch inst.Operands[1].(type) {
+		case OperandImmediate:
+			cycles = operandCycles(inst.Operands[0], 5, 11)
+		default:
+			cycles = operandCycles(inst.Operands[0], 3, 9)
+		}
+
+	case "inc", "dec":
+		cycles = operandCycles(inst.Operands[0], 3, 15)
+		if reg, ok := inst.Operands[0].(OperandRegister); ok && reg.Size == 2 {
+			cycles = 2
+		}
+
+	case "neg", "not":
+		cycles = operandCycles(inst.Operands[0], 3, 16)
+
+	case "shl", "shr", "sar", "rol", "ror", "rcl", "rcr":
+		if count, ok := inst.Operands[1].(OperandImmediate); ok && count.Value == 1 {
+			cycles = operandCycles(inst.Operands[0], 2, 15)
+			break
+		}
+
+		cycles = operandCycles(inst.Operands[0], 8, 20) + 4*inst.Repetitions
+
+	case "mul", "imul", "div", "idiv":
+		// the fastest case of each, the real cost depends on the operands
+		costs := map[string][2]int{
+			"mul":  {70, 118},
+			"imul": {80, 128},
+			"div":  {80, 144},
+			"idiv": {101, 165},
+		}[inst.Op]
+
+		cycles = costs[0]
+		if inst.Wide {
+			cycles = costs[1]
+		}
+
+		if isMemoryOperand(inst.Operands[0]) {
+			cycles += 6 + EstimateCycles(inst.Operands[0])
+		}
+
+	case "push":
+		cycles = operandCycles(inst.Operands[0], 11, 16)
+		if reg, ok := inst.Operands[0].(OperandRegister); ok && reg.Index >= RI_es {
+			cycles = 10
+		}
+
+	case "pop":
+		cycles = operandCycles(inst.Operands[0], 8, 17)
+
+	case "xchg":
+		cycles = operandCycles(inst.Operands[0], 4, 17)
+
+	case "lea":
+		cycles = 2 + EstimateCycles(inst.Operands[1])
+
+	case "lds", "les":
+		cycles = 16 + EstimateCycles(inst.Operands[1])
+
+	case "pushf":
+		cycles = 10
+	case "popf":
+		cycles = 8
+	case "lahf", "sahf":
+		cycles = 4
+	case "cbw", "clc", "cmc", "stc", "cld", "std", "cli", "sti", "hlt":
+		cycles = 2
+	case "nop":
+		cycles = 3
+	case "cwd":
+		cycles = 5
+	case "xlat":
+		cycles = 11
+
+	case "jo", "jno", "jb", "jnb", "jz", "jne", "jbe", "ja",
+		"js", "jns", "jp", "jnp", "jl", "jnl", "jle", "jg":
+		cycles = takenCycles(inst, 16, 4)
+	case "loop":
+		cycles = takenCycles(inst, 17, 5)
+	case "loopz", "jcxz":
+		cycles = takenCycles(inst, 18, 6)
+	case "loopnz":
+		cycles = takenCycles(inst, 19, 5)
+
+	case "jmp", "call":
+		// direct, through a register, through memory; near then far
+		costs := map[string][2][3]int{
+			"jmp":  {{15, 11, 18}, {15, 0, 24}},
+			"call": {{19, 16, 21}, {28, 0, 37}},
+		}[inst.Op][BoolToInt(inst.Far)]
+
+		switch target := inst.Operands[0].(type) {
+		case nil, OperandFarAddress:
+			cycles = costs[0]
+		default:
+			cycles = operandCycles(target, costs[1], costs[2])
+		}
+
+	case "ret":
+		cycles = 8
+		if inst.Operands[1] != nil {
+			cycles = 12
+		}
+	case "retf":
+		cycles = 18
+		if inst.Operands[1] != nil {
+			cycles = 17
+		}
+
+	case "int":
+		cycles = 51
+	case "int3":
+		cycles = 52
+	case "into":
+		cycles = takenCycles(inst, 53, 4)
+	case "iret":
+		cycles = 24
+
+	case "in", "out":
+		// the port number is either fixed or in dx
+		port := inst.Operands[1]
+		if inst.Op == "out" {
+			port = inst.Operands[0]
+		}
+
+		cycles = 8
+		if _, ok := port.(OperandImmediate); ok {
+			cycles = 10
+		}
+
+		cycles += inst.Waits
+
 	case "cmp":
 		switch left := inst.Operands[0].(type) {
 		case OperandRegister:
@@ -121,3 +278,23 @@ func (inst Instruction) EstimateCycles() (cycles int) {
 
 	return
 }
+
+// operandCycles picks the register or memory form timing of an instruction,
+// memory forms paying for the effective address on top.
+func operandCycles(op Operand, register, memory int) int {
+	if isMemoryOperand(op) {
+		return memory + EstimateCycles(op)
+	}
+
+	return register
+}
+
+// takenCycles is the cost of a conditional transfer, which is much cheaper
+// when it falls through.
+func takenCycles(inst Instruction, taken, notTaken int) int {
+	if inst.Taken {
+		return taken
+	}
+
+	return notTaken
+}
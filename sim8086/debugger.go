@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const debuggerHelp = `commands, numbers and addresses in hex:
+  s, step [n]            run n instructions, showing the trace
+  c, continue            run until a breakpoint or the end, quietly
+  rs, rstep [n]          undo n instructions
+  rc, rcontinue          run backwards until a breakpoint or the start
+  lw, lastwrite ADDR [n] run back to the last write to the n bytes at ADDR
+  b, break ADDR          stop before the instruction at ADDR
+  b, break [ADDR] if EXPR   only when EXPR holds, anywhere without ADDR
+  watch ADDR [n]         stop after anything writes the n bytes at ADDR
+  d, delete [N]          remove breakpoint or watchpoint N, or all of them
+  bl, breakpoints        list breakpoints and watchpoints
+  p, print EXPR          evaluate an expression, see below
+  r, regs                show registers and flags
+  set REG VALUE          change a register
+  x, examine ADDR [n]    dump n bytes of memory, 80 by default
+  w, write ADDR BYTE...  store bytes into memory
+  u, disasm [ADDR] [n]   disassemble n instructions, around ip by default
+  h, help                this list
+  q, quit                stop debugging
+an empty line repeats the last step, continue or disasm, either way; ADDR is
+SEG:OFF or OFF in cs, and either part can be a register like ds:si; running
+backwards restores registers and memory, not devices or what was printed
+
+expressions are C-like over registers, flags (cf, zf, ...) and memory, with
+decimal or 0x numbers: ax == 0x10 && word [bp+si+4] > 3`
+
+// Breakpoint stops before the instruction at Address runs, or before any
+// instruction when Anywhere, provided Condition is unset or true.
+type Breakpoint struct {
+	Number    int
+	Address   uint32
+	Anywhere  bool
+	Condition Expr
+	Text      string // as it was typed, for listing
+}
+
+// Watchpoint stops after an instruction stores into Length bytes at Start.
+type Watchpoint struct {
+	Number int
+	Start  uint32
+	Length uint32
+	Text   string
+}
+
+type watchHit struct {
+	watchpoint int
+	address    uint32
+	old, value byte
+}
+
+// Debugger drives the simulation from commands, one instruction at a time.
+type Debugger struct {
+	step      func() bool
+	registers Registers
+	memory    Memory
+	input     *bufio.Reader
+
+	breakpoints []Breakpoint
+	watchpoints []Watchpoint
+	numbered    int // breakpoints and watchpoints handed out so far
+
+	history   History
+	running   bool       // a step is in progress, so stores are the program's
+	reversing bool       // the last step was undone rather than run
+	hits      []watchHit // watched stores made by the last step
+	ran       [2]uint16  // cs:ip of the last instruction stepped
+
+	finished bool   // the program is over, nothing left to run
+	last     string // command an empty line repeats
+}
+
+func NewDebugger(step func() bool, registers Registers, memory Memory,
+	input *bufio.Reader) *Debugger {
+	d := &Debugger{step: step, registers: registers, memory: memory, input: input}
+	StoreHooks = append(StoreHooks, d.watch, d.history.Store)
+
+	return d
+}
+
+// Run reads commands until quit or the end of input.
+func (d *Debugger) Run() {
+	fmt.Println("; debugging, h for help")
+	d.where()
+
+	for {
+		fmt.Print("(sim8086) ")
+
+		line, err := d.input.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = d.last
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "q" || fields[0] == "quit" {
+			return
+		}
+
+		if err := d.command(fields[0], fields[1:]); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func (d *Debugger) command(name string, args []string) error {
+	switch name {
+	case "s", "step":
+		d.last = name
+
+		count, err := d.count(args, 1)
+		if err != nil {
+			return err
+		}
+
+		for range count {
+			if !d.run() || d.stopped() {
+				break
+			}
+		}
+		d.where()
+
+	case "c", "continue":
+		d.last = name
+
+		// quiet, but the instruction a breakpoint stops on isn't one to skip,
+		// and why the program ended still shows
+		QuietSteps = true
+		for d.run() && !d.stopped() {
+		}
+		QuietSteps = false
+
+		d.where()
+
+	case "rs", "rstep":
+		d.last = name
+
+		count, err := d.count(args, 1)
+		if err != nil {
+			return err
+		}
+
+		for range count {
+			if _, ok := d.reverse(); !ok || d.stopped() {
+				break
+			}
+		}
+		d.where()
+
+	case "rc", "rcontinue":
+		d.last = name
+
+		for {
+			if _, ok := d.reverse(); !ok || d.stopped() {
+				break
+			}
+		}
+		d.where()
+
+	case "lw", "lastwrite":
+		if len(args) == 0 {
+			return fmt.Errorf("lastwrite needs an address")
+		}
+
+		start, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+
+		length, err := d.count(args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+	back:
+		for {
+			delta, ok := d.reverse()
+			if !ok {
+				break
+			}
+
+			for _, change := range delta.Memory {
+				if change.Address-start < uint32(length) {
+					fmt.Printf("; %05x 0x%02x->0x%02x by the instruction at %04x:%04x\n",
+						change.Address, change.Old, change.Value, d.ran[0], d.ran[1])
+					break back
+				}
+			}
+		}
+		d.where()
+
+	case "b", "break":
+		breakpoint := Breakpoint{Anywhere: true, Text: strings.Join(args, " ")}
+
+		if len(args) > 0 && args[0] != "if" {
+			address, err := d.address(args[0])
+			if err != nil {
+				return err
+			}
+
+			breakpoint.Address = address
+			breakpoint.Anywhere = false
+			args = args[1:]
+		}
+
+		if len(args) > 0 {
+			if args[0] != "if" || len(args) == 1 {
+				return fmt.Errorf("break takes an address, a condition after if, or both")
+			}
+
+			condition, err := ParseExpr(strings.Join(args[1:], " "))
+			if err != nil {
+				return err
+			}
+
+			breakpoint.Condition = condition
+		}
+
+		if breakpoint.Anywhere && breakpoint.Condition == nil {
+			return fmt.Errorf("break needs an address or a condition")
+		}
+
+		d.numbered++
+		breakpoint.Number = d.numbered
+		d.breakpoints = append(d.breakpoints, breakpoint)
+		fmt.Printf("; breakpoint %d\n", breakpoint.Number)
+
+	case "watch":
+		if len(args) == 0 {
+			return fmt.Errorf("watch needs an address")
+		}
+
+		start, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+
+		length, err := d.count(args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		d.numbered++
+		watchpoint := Watchpoint{d.numbered, start, uint32(length), strings.Join(args, " ")}
+		d.watchpoints = append(d.watchpoints, watchpoint)
+		fmt.Printf("; watchpoint %d\n", d.numbered)
+
+	case "d", "delete":
+		if len(args) == 0 {
+			d.breakpoints = nil
+			d.watchpoints = nil
+			break
+		}
+
+		number, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("bad breakpoint number %q", args[0])
+		}
+
+		d.breakpoints = slices.DeleteFunc(d.breakpoints, func(b Breakpoint) bool {
+			return b.Number == number
+		})
+		d.watchpoints = slices.DeleteFunc(d.watchpoints, func(w Watchpoint) bool {
+			return w.Number == number
+		})
+
+	case "bl", "breakpoints":
+		for _, b := range d.breakpoints {
+			fmt.Printf("%d: break %s\n", b.Number, b.Text)
+		}
+		for _, w := range d.watchpoints {
+			fmt.Printf("%d: watch %s\n", w.Number, w.Text)
+		}
+
+	case "p", "print":
+		expr, err := ParseExpr(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+
+		value := expr(d.registers, d.memory)
+		fmt.Printf("0x%04x (%d)\n", value, int16(value))
+
+	case "r", "regs":
+		d.printRegisters()
+
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("set needs a register and a value")
+		}
+
+		reg, ok := LookupRegister(args[0])
+		if !ok {
+			return fmt.Errorf("no register %q", args[0])
+		}
+
+		value, err := d.value(args[1])
+		if err != nil {
+			return err
+		}
+
+		SetRegisterValue(reg, int16(value), d.registers)
+
+	case "x", "examine":
+		if len(args) == 0 {
+			return fmt.Errorf("examine needs an address")
+		}
+
+		address, err := d.address(args[0])
+		if err != nil {
+			return err
+		}
+
+		count, err := d.count(args[1:], 0x50)
+		if err != nil {
+			return err
+		}
+
+		d.dump(address, count)
+
+	case "w", "write":
+		if len(args) < 2 {
+			return fmt.Errorf("write needs an address and bytes")
+		}
+
+		segment, offset, err := d.segmentOffset(args[0])
+		if err != nil {
+			return err
+		}
+
+		for i, arg := range args[1:] {
+			value, err := strconv.ParseUint(arg, 16, 8)
+			if err != nil {
+				return fmt.Errorf("bad byte %q", arg)
+			}
+
+			d.memory.Store(segment, offset+uint16(i), uint16(value), false)
+		}
+
+	case "u", "disasm":
+		d.last = name
+
+		segment, offset := uint16(d.registers[RI_cs]), uint16(d.registers[RI_ip])
+		around := len(args) == 0
+		if !around {
+			var err error
+			if segment, offset, err = d.segmentOffset(args[0]); err != nil {
+				return err
+			}
+		}
+
+		count, err := d.count(args, 10)
+		if len(args) > 0 {
+			count, err = d.count(args[1:], 10)
+		}
+		if err != nil {
+			return err
+		}
+
+		d.disassemble(segment, offset, count, around)
+
+	case "h", "help":
+		fmt.Println(debuggerHelp)
+
+	default:
+		return fmt.Errorf("unknown command %q, h for help", name)
+	}
+
+	return nil
+}
+
+// run steps once, unless the program already ended; false when it has.
+func (d *Debugger) run() bool {
+	if d.finished {
+		return false
+	}
+
+	d.hits = nil
+	d.ran = [2]uint16{uint16(d.registers[RI_cs]), uint16(d.registers[RI_ip])}
+
+	d.running, d.reversing = true, false
+	d.history.Begin(d.registers)
+	d.finished = d.step()
+	d.history.End(d.registers, d.finished)
+	d.running = false
+
+	return !d.finished
+}
+
+// reverse undoes the last step, giving what it changed; false once there is
+// no history left.
+func (d *Debugger) reverse() (Delta, bool) {
+	d.hits = nil
+
+	d.running, d.reversing = true, true
+	delta, ok := d.history.Undo(d.registers, d.memory)
+	d.running = false
+
+	if !ok {
+		fmt.Println("; at the start of the recorded history")
+		return delta, false
+	}
+
+	d.finished = false
+	d.ran = [2]uint16{uint16(d.registers[RI_cs]), uint16(d.registers[RI_ip])}
+
+	return delta, true
+}
+
+func (d *Debugger) ip() uint32 {
+	return PhysicalAddress(uint16(d.registers[RI_cs]), uint16(d.registers[RI_ip]))
+}
+
+// watch is the store hook that notices writes to watched memory.
+func (d *Debugger) watch(address uint32, old, value byte) {
+	if !d.running {
+		return
+	}
+
+	for _, w := range d.watchpoints {
+		if address-w.Start < w.Length {
+			d.hits = append(d.hits, watchHit{w.Number, address, old, value})
+		}
+	}
+}
+
+// stopped tells whether a watchpoint went off during the last step or a
+// breakpoint applies to the next instruction, saying which.
+func (d *Debugger) stopped() bool {
+	stop := false
+
+	how := "by"
+	if d.reversing {
+		how = "undoing"
+	}
+
+	for _, hit := range d.hits {
+		fmt.Printf("; watchpoint %d: %05x 0x%02x->0x%02x %s the instruction at %04x:%04x\n",
+			hit.watchpoint, hit.address, hit.old, hit.value, how, d.ran[0], d.ran[1])
+		stop = true
+	}
+
+	ip := d.ip()
+	for _, b := range d.breakpoints {
+		here := b.Anywhere || b.Address == ip
+		if here && (b.Condition == nil || b.Condition(d.registers, d.memory) != 0) {
+			fmt.Printf("; breakpoint %d: %s\n", b.Number, b.Text)
+			stop = true
+		}
+	}
+
+	return stop
+}
+
+// where shows the instruction about to run.
+func (d *Debugger) where() {
+	if d.finished {
+		fmt.Println("; the program is over")
+		return
+	}
+
+	d.disassemble(uint16(d.registers[RI_cs]), uint16(d.registers[RI_ip]), 1, false)
+}
+
+func (d *Debugger) printRegisters() {
+	names := []RegisterIndex{
+		RI_a, RI_b, RI_c, RI_d, RI_sp, RI_bp, RI_si, RI_di,
+		RI_es, RI_cs, RI_ss, RI_ds, RI_ip,
+	}
+
+	for i, idx := range names {
+		fmt.Printf("%s=%04x", OperandRegister{idx, 0, 2}, uint16(d.registers[idx]))
+		if i%8 == 7 || i == len(names)-1 {
+			fmt.Println()
+		} else {
+			fmt.Print("  ")
+		}
+	}
+
+	PrintFlags(d.registers[RI_flags])
+}
+
+// dump shows memory as hex and printable characters, 16 bytes a row.
+func (d *Debugger) dump(address uint32, count int) {
+	for row := 0; row < count; row += 16 {
+		var hex, text strings.Builder
+
+		for i := row; i < min(row+16, count); i++ {
+			b := d.memory[(address+uint32(i))%MemorySize]
+			fmt.Fprintf(&hex, "%02x ", b)
+
+			if b >= 0x20 && b < 0x7f {
+				text.WriteByte(b)
+			} else {
+				text.WriteByte('.')
+			}
+		}
+
+		fmt.Printf("%05x  %-48s %s\n", (address+uint32(row))%MemorySize, hex.String(), text.String())
+	}
+}
+
+// disassemble lists count instructions from segment:offset. Around ip it
+// starts a few instructions earlier, at the furthest point back that decodes
+// into a run landing exactly on ip, since 8086 code can't be read backwards.
+func (d *Debugger) disassemble(segment, offset uint16, count int, around bool) {
+	if around {
+		const lookBack = 24
+		const before = 3
+
+		for back := uint16(min(lookBack, offset)); back > 0; back-- {
+			starts := d.decodeRun(segment, offset-back, offset)
+			if starts != nil {
+				offset = starts[max(len(starts)-before, 0)]
+				break
+			}
+		}
+	}
+
+	current := d.ip()
+
+	for range count {
+		address := PhysicalAddress(segment, offset)
+
+		window := d.memory.Fetch(segment, offset)
+
+		instruction, err := DecodeInstruction(0, window)
+		if err != nil {
+			fmt.Printf("   %04x:%04x  %s\n", segment, offset, err)
+			return
+		}
+
+		var hex strings.Builder
+		for _, b := range window[:instruction.Size] {
+			fmt.Fprintf(&hex, "%02x", b)
+		}
+
+		marker := "  "
+		if address == current {
+			marker = "=>"
+		}
+
+		fmt.Printf("%s %04x:%04x  %-14s %s\n", marker, segment, offset, hex.String(), instruction)
+		offset += uint16(instruction.Size)
+	}
+}
+
+// decodeRun returns where each instruction starts when decoding from start
+// on, or nil if no instruction starts exactly at end.
+func (d *Debugger) decodeRun(segment, start, end uint16) []uint16 {
+	var starts []uint16
+
+	for offset := start; offset < end; {
+		instruction, err := DecodeInstruction(0, d.memory.Fetch(segment, offset))
+		if err != nil {
+			return nil
+		}
+
+		starts = append(starts, offset)
+		offset += uint16(instruction.Size)
+
+		if offset == end {
+			return starts
+		}
+	}
+
+	return nil
+}
+
+func (d *Debugger) count(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+
+	count, err := strconv.ParseUint(args[0], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad count %q", args[0])
+	}
+
+	return int(count), nil
+}
+
+// value reads a hex number or the contents of a register.
+func (d *Debugger) value(text string) (uint16, error) {
+	if reg, ok := LookupRegister(text); ok {
+		return uint16(GetRegisterValue(reg, d.registers)), nil
+	}
+
+	value, err := strconv.ParseUint(strings.TrimPrefix(text, "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", text)
+	}
+
+	return uint16(value), nil
+}
+
+// segmentOffset reads SEG:OFF, or just OFF in the code segment.
+func (d *Debugger) segmentOffset(text string) (segment, offset uint16, err error) {
+	segment = uint16(d.registers[RI_cs])
+
+	segmentText, offsetText, found := strings.Cut(text, ":")
+	if !found {
+		offsetText = text
+	} else if segment, err = d.value(segmentText); err != nil {
+		return 0, 0, err
+	}
+
+	offset, err = d.value(offsetText)
+
+	return segment, offset, err
+}
+
+func (d *Debugger) address(text string) (uint32, error) {
+	segment, offset, err := d.segmentOffset(text)
+
+	return PhysicalAddress(segment, offset), err
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// debug runs a program under the debugger with commands typed one a line.
+func debug(t *testing.T, path string, commands ...string) string {
+	t.Helper()
+
+	stdout, _ := simulateInput(t, strings.Join(commands, "\n")+"\n", "-mode", "debug", "-path", path)
+
+	return stdout
+}
+
+// expectInOrder checks each of want appears in output, each after the last.
+func expectInOrder(t *testing.T, output string, want ...string) {
+	t.Helper()
+
+	rest := output
+	for _, text := range want {
+		i := strings.Index(rest, text)
+		if i < 0 {
+			t.Fatalf("no %q after what came before in:\n%s", text, output)
+		}
+
+		rest = rest[i+len(text):]
+	}
+}
+
+func TestDebuggerSession(t *testing.T) {
+	output := debug(t, "listings/exec/listing_0052_memory_add_loop",
+		"s",
+		"s 3",
+		"",
+		"b 1a",
+		"c",
+		"r",
+		"x ds:3e8 6",
+		"u",
+		"set ax 1234",
+		"p ax",
+		"jump",
+		"s zz",
+		"s 10000",
+		"q",
+	)
+
+	expectInOrder(t, output,
+		"; debugging, h for help\n=> 0000:0000  ba0600         mov dx, word 6\n",
+		// one step traces the instruction and shows the next
+		"(sim8086) mov dx, word 6\n; dx 0x0000->0x0006\n=> 0000:0003  bde803         mov bp, word 1000\n",
+		"(sim8086) mov bp, word 1000\n; bp 0x0000->0x03e8\nmov si, word 0\n",
+		"mov [bp+si+0], si\n",
+		"=> 0000:000b  83c602         add si, word 2\n",
+		// an empty line steps again
+		"(sim8086) add si, word 2\n",
+		"; si 0x0000->0x0002\n=> 0000:000e",
+		"(sim8086) ; breakpoint 1\n",
+		// continuing is quiet up to the breakpoint
+		"(sim8086) ; breakpoint 1: 1a\n=> 0000:001a  01cb           add bx, cx\n",
+		"(sim8086) ax=0000  bx=0000  cx=0000  dx=0006  sp=0000  bp=03e8  si=0000  di=0000\n"+
+			"es=0000  cs=0000  ss=0000  ds=0000  ip=001a\n",
+		"(sim8086) 003e8  00 00 02 00 04 00                                ......\n",
+		// disassembly starts a few instructions back to land on ip
+		"(sim8086)    0000:0012  bb0000         mov bx, word 0\n",
+		"=> 0000:001a  01cb           add bx, cx\n",
+		"(sim8086) (sim8086) 0x1234 (4660)\n",
+		"(sim8086) unknown command \"jump\", h for help\n",
+		"(sim8086) bad count \"zz\"\n",
+		// counts are 16 bits everywhere
+		"(sim8086) bad count \"10000\"\n",
+	)
+
+	if strings.Contains(output, "add bx, cx\n; bx") {
+		t.Errorf("continue traced the instructions it ran:\n%s", output)
+	}
+}
+
+func TestDebuggerRunsToTheEnd(t *testing.T) {
+	output := debug(t, "listings/exec/listing_0043_immediate_movs", "c", "s", "r")
+
+	expectInOrder(t, output,
+		"(sim8086) ; the program is over\n",
+		"(sim8086) ; the program is over\n",
+		"(sim8086) ax=0001  bx=0002  cx=0003  dx=0004  sp=0005  bp=0006  si=0007  di=0008\n",
+		// the end of input leaves the debugger and the program is summed up
+		"; Registers\n",
+	)
+}
+
+func TestDebuggerContinueShowsTheEnd(t *testing.T) {
+	// mov ah, 0ffh; int 21h
+	path := filepath.Join(t.TempDir(), "bad.com")
+	if err := os.WriteFile(path, []byte{0xb4, 0xff, 0xcd, 0x21}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := debug(t, path, "c")
+
+	expectInOrder(t, output,
+		"(sim8086) ; unsupported dos function ffh\n; the program is over\n",
+	)
+
+	if strings.Count(output, "mov ah") > 1 {
+		t.Errorf("continue traced the instructions it ran:\n%s", output)
+	}
+}
+
+func TestDebuggerBreakpointsAndWatchpoints(t *testing.T) {
+	output := debug(t, "listings/exec/listing_0052_memory_add_loop",
+		"watch 3ec 2",
+		"b 1a if bx > 1",
+		"bl",
+		"c",
+		"d 1",
+		"c",
+		"p bx + cx * 2",
+		"d",
+		"c",
+		"b",
+		"b 1a if",
+		"b if (",
+	)
+
+	expectInOrder(t, output,
+		"(sim8086) ; watchpoint 1\n",
+		"(sim8086) ; breakpoint 2\n",
+		"(sim8086) 2: break 1a if bx > 1\n1: watch 3ec 2\n",
+		// a watchpoint stops after the store, reporting each byte
+		"(sim8086) ; watchpoint 1: 003ec 0x00->0x04 by the instruction at 0000:0009\n"+
+			"; watchpoint 1: 003ed 0x00->0x00 by the instruction at 0000:0009\n"+
+			"=> 0000:000b  83c602         add si, word 2\n",
+		// the first two times round bx is still 0
+		"(sim8086) (sim8086) ; breakpoint 2: 1a if bx > 1\n=> 0000:001a  01cb           add bx, cx\n",
+		"(sim8086) 0x000a (10)\n",
+		"(sim8086) (sim8086) ; the program is over\n",
+		"(sim8086) break needs an address or a condition\n",
+		"(sim8086) break takes an address, a condition after if, or both\n",
+		"(sim8086) expression ends too soon\n",
+	)
+}
+
+func TestDebuggerReverse(t *testing.T) {
+	output := debug(t, "listings/exec/listing_0052_memory_add_loop",
+		"s 5",
+		"rs",
+		"rs 2",
+		"r",
+		"b 1a",
+		"c",
+		"c",
+		"lw 3ec",
+		"x 3e8 6",
+		"rc",
+		"x 3e8 6",
+		"rs",
+		"c",
+		"c",
+		"c",
+		"c",
+		"rc",
+		"p bx",
+		"d",
+		"rc",
+	)
+
+	expectInOrder(t, output,
+		"; si 0x0000->0x0002\n=> 0000:000e  39d6           cmp si, dx\n",
+		"(sim8086) => 0000:000b  83c602         add si, word 2\n",
+		"(sim8086) => 0000:0006  be0000         mov si, word 0\n",
+		// registers go back with the instructions
+		"(sim8086) ax=0000  bx=0000  cx=0000  dx=0006  sp=0000  bp=03e8  si=0000  di=0000\n"+
+			"es=0000  cs=0000  ss=0000  ds=0000  ip=0006\n",
+		"(sim8086) ; breakpoint 1: 1a\n",
+		"(sim8086) ; breakpoint 1: 1a\n",
+		// back past the loop adding to the one that stored it
+		"(sim8086) ; 003ec 0x00->0x04 by the instruction at 0000:0009\n=> 0000:0009  8932           mov [bp+si+0], si\n",
+		"(sim8086) 003e8  00 00 02 00 00 00                                ......\n",
+		"(sim8086) ; at the start of the recorded history\n=> 0000:0000  ba0600         mov dx, word 6\n",
+		// and memory with them
+		"(sim8086) 003e8  00 00 00 00 00 00                                ......\n",
+		"(sim8086) ; at the start of the recorded history\n",
+		"(sim8086) ; breakpoint 1: 1a\n",
+		"(sim8086) ; breakpoint 1: 1a\n",
+		"(sim8086) ; breakpoint 1: 1a\n",
+		"(sim8086) ; the program is over\n",
+		// running backwards stops at breakpoints too, the last time round
+		"(sim8086) ; breakpoint 1: 1a\n=> 0000:001a  01cb           add bx, cx\n",
+		"(sim8086) 0x0002 (2)\n",
+		"(sim8086) (sim8086) ; at the start of the recorded history\n",
+		"\n; Registers\n; Flags: \n",
+	)
+}
+
+func TestDebuggerReverseOverNothing(t *testing.T) {
+	// mov ax, 1; jmp $
+	path := filepath.Join(t.TempDir(), "spin")
+	if err := os.WriteFile(path, []byte{0xb8, 0x01, 0x00, 0xeb, 0xfe}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := debug(t, path, "s", "s 3", "rs 3", "p ax", "rs", "p ax", "rs")
+
+	expectInOrder(t, output,
+		"(sim8086) mov ax, word 1\n",
+		// jumping to itself changes nothing, but each time is a step to undo
+		"(sim8086) => 0000:0003  ebfe           jmp byte 254\n",
+		"(sim8086) 0x0001 (1)\n",
+		"(sim8086) => 0000:0000  b80100         mov ax, word 1\n",
+		"(sim8086) 0x0000 (0)\n",
+		"(sim8086) ; at the start of the recorded history\n",
+	)
+}
@@ -13,6 +13,38 @@ func DecodeInstruction(startingAt int, buff []byte) (*Instruction, error) {
 
 	currentByteIndex := startingAt
 
+	var lock bool
+	var rep string
+	var segment string
+
+prefixes:
+	for currentByteIndex < len(buff) {
+		switch buff[currentByteIndex] {
+		case 0xf0:
+			lock = true
+		case 0xf2:
+			rep = "repne"
+		case 0xf3:
+			rep = "rep"
+		case 0x26:
+			segment = "es"
+		case 0x2e:
+			segment = "cs"
+		case 0x36:
+			segment = "ss"
+		case 0x3e:
+			segment = "ds"
+		default:
+			break prefixes
+		}
+
+		currentByteIndex++
+	}
+
+	if currentByteIndex >= len(buff) {
+		return nil, errors.New("EOF")
+	}
+
 	for _, bp := range Blueprints {
 		var bitsSet uint32
 		var bitsLeft int
@@ -24,6 +56,11 @@ func DecodeInstruction(startingAt int, buff []byte) (*Instruction, error) {
 		isValid := true
 		for _, part := range bp.Bits {
 			if bitsLeft == 0 && part.BitCount != 0 {
+				if currentByteIndex+bytesRead >= len(buff) {
+					isValid = false
+					break
+				}
+
 				currentByte = buff[currentByteIndex+bytesRead]
 				bitsLeft = 8
 				bytesRead++
@@ -64,11 +101,24 @@ func DecodeInstruction(startingAt int, buff []byte) (*Instruction, error) {
 		w := bits[Bits_W] == 1
 		s := bits[Bits_S] == 1
 
+		// an instruction can run off the end of what's there to decode
+		truncated := false
+
 		readFromBuff := func(exists bool, wide bool, signExtended bool) uint16 {
 			if !exists {
 				return 0
 			}
 
+			size := 1
+			if wide {
+				size = 2
+			}
+
+			if currentByteIndex+bytesRead+size > len(buff) {
+				truncated = true
+				return 0
+			}
+
 			if wide {
 				lo := uint16(buff[currentByteIndex+bytesRead+0])
 				hi := uint16(buff[currentByteIndex+bytesRead+1])
@@ -92,19 +142,28 @@ func DecodeInstruction(startingAt int, buff []byte) (*Instruction, error) {
 			(mod == 0b10 || mod == 0b01 || hasDirectAddress)
 		hasData := isTypeSet(bitsSet, Bits_HasData)
 
-		bits[Bits_HasDisp] = readFromBuff(hasDisp, mod == 0b10 || hasDirectAddress, w)
+		bits[Bits_HasDisp] = readFromBuff(hasDisp, mod == 0b10 || hasDirectAddress, true)
 		bits[Bits_HasData] = readFromBuff(hasData, w && !s, s)
 
 		var instruction Instruction
 
 		if isTypeSet(bitsSet, Bits_Mod) {
-			instruction.Operands[0] = DecodeRm(rm, mod, w, bits[Bits_HasDisp])
+			rmWide := w || isTypeSet(bitsSet, Bits_RmAlwaysW)
+			instruction.Operands[0] = DecodeRm(rm, mod, rmWide, bits[Bits_HasDisp])
 		} else if isTypeSet(bitsSet, Bits_HasAddr) {
-			instruction.Operands[0] = OperandDirectAddress(readFromBuff(true, w, false))
+			address := readFromBuff(true, true, false)
+			if isTypeSet(bitsSet, Bits_Far) {
+				segment := readFromBuff(true, true, false)
+				instruction.Operands[0] = OperandFarAddress{segment, address}
+			} else {
+				instruction.Operands[0] = OperandDirectAddress{Address: address, Wide: w}
+			}
 		}
 
 		if isTypeSet(bitsSet, Bits_Reg) {
 			instruction.Operands[1] = DecodeReg(bits[Bits_Reg], w)
+		} else if isTypeSet(bitsSet, Bits_SR) {
+			instruction.Operands[1] = DecodeSegmentReg(bits[Bits_SR])
 		}
 
 		if bits[Bits_D] == 1 || (isTypeSet(bitsSet, Bits_E) && bits[Bits_E] == 0) {
@@ -115,8 +174,49 @@ func DecodeInstruction(startingAt int, buff []byte) (*Instruction, error) {
 			instruction.Operands[1] = OperandImmediate{bits[Bits_HasData], w}
 		}
 
+		// shift count is either cl or 1
+		if isTypeSet(bitsSet, Bits_V) {
+			if bits[Bits_V] == 1 {
+				instruction.Operands[1] = DecodeReg(0b001, false)
+			} else {
+				instruction.Operands[1] = OperandImmediate{1, false}
+			}
+		}
+
+		// port number takes whichever side the accumulator left free
+		if isTypeSet(bitsSet, Bits_Port) {
+			port := OperandImmediate{bits[Bits_Port], false}
+			if instruction.Operands[0] == nil {
+				instruction.Operands[0] = port
+			} else {
+				instruction.Operands[1] = port
+			}
+		}
+
+		if segment != "" {
+			for i, op := range instruction.Operands {
+				switch op := op.(type) {
+				case OperandDirectAddress:
+					op.Segment = segment
+					instruction.Operands[i] = op
+				case OperandEffectiveAddress:
+					op.Segment = segment
+					instruction.Operands[i] = op
+				}
+			}
+		}
+
 		instruction.Op = bp.Name
-		instruction.Size = bytesRead
+		instruction.Wide = w
+		instruction.Lock = lock
+		instruction.Rep = rep
+		instruction.Segment = segment
+		instruction.Far = isTypeSet(bitsSet, Bits_Far)
+		instruction.Size = currentByteIndex - startingAt + bytesRead
+
+		if truncated {
+			return nil, errors.New("EOF")
+		}
 
 		return &instruction, nil
 	}
@@ -128,7 +228,7 @@ func DecodeRm(rm uint16, mod uint16, wide bool, disp uint16) Operand {
 	switch mod {
 	case 0b00:
 		if rm == 0b110 {
-			return OperandDirectAddress(disp)
+			return OperandDirectAddress{Address: disp, Wide: wide}
 		}
 		return eac(rm, wide, disp)
 
@@ -157,7 +257,7 @@ func eac(rm uint16, wide bool, disp uint16) OperandEffectiveAddress {
 		"bx",
 	}
 
-	return OperandEffectiveAddress{regs[rm], int16(disp), wide}
+	return OperandEffectiveAddress{Base: regs[rm], Disp: int16(disp), Wide: wide}
 }
 
 type RegisterIndex byte
@@ -171,6 +271,10 @@ const (
 	RI_bp
 	RI_si
 	RI_di
+	RI_es
+	RI_cs
+	RI_ss
+	RI_ds
 	RI_ip
 
 	RI_flags
@@ -180,11 +284,19 @@ const (
 
 type RegisterFlag int
 
+// positions match the bits of the 8086 flags register
 const (
-	RF_zero RegisterFlag = iota
-	RF_sign
-
-	RF_Count
+	RF_carry     RegisterFlag = 0
+	RF_parity    RegisterFlag = 2
+	RF_aux       RegisterFlag = 4
+	RF_zero      RegisterFlag = 6
+	RF_sign      RegisterFlag = 7
+	RF_trap      RegisterFlag = 8
+	RF_interrupt RegisterFlag = 9
+	RF_direction RegisterFlag = 10
+	RF_overflow  RegisterFlag = 11
+
+	RF_Count = 12
 )
 
 func DecodeReg(reg uint16, wide bool) OperandRegister {
@@ -209,6 +321,30 @@ func DecodeReg(reg uint16, wide bool) OperandRegister {
 	return regs[reg][idx]
 }
 
+func DecodeSegmentReg(sr uint16) OperandRegister {
+	regs := []RegisterIndex{RI_es, RI_cs, RI_ss, RI_ds}
+
+	return OperandRegister{regs[sr], 0, 2}
+}
+
+// LookupRegister finds a register, byte halves included, by its name.
+func LookupRegister(name string) (OperandRegister, bool) {
+	for idx := RI_a; idx < RI_Count; idx++ {
+		candidates := []OperandRegister{{idx, 0, 2}}
+		if idx <= RI_b {
+			candidates = append(candidates, OperandRegister{idx, 0, 1}, OperandRegister{idx, 1, 1})
+		}
+
+		for _, reg := range candidates {
+			if reg.String() == name {
+				return reg, true
+			}
+		}
+	}
+
+	return OperandRegister{}, false
+}
+
 func isTypeSet(flags uint32, bitsType BitsType) bool {
 	bit := uint32(1 << bitsType)
 	return flags&bit == bit
@@ -234,7 +370,12 @@ func (reg OperandRegister) String() string {
 		{"", "", "bp"},
 		{"", "", "si"},
 		{"", "", "di"},
+		{"", "", "es"},
+		{"", "", "cs"},
+		{"", "", "ss"},
+		{"", "", "ds"},
 		{"", "", "ip"},
+		{"", "", "flags"},
 	}
 
 	idx := reg.Offset
@@ -259,29 +400,94 @@ func (imm OperandImmediate) String() string {
 	return fmt.Sprintf("%s %d", size, imm.Value)
 }
 
-type OperandDirectAddress int
+type OperandDirectAddress struct {
+	Address uint16
+	Wide    bool
+	Segment string // override prefix, empty for the default
+}
 
 func (addr OperandDirectAddress) String() string {
-	return fmt.Sprintf("[%d]", addr)
+	return fmt.Sprintf("%s[%d]", segmentPrefix(addr.Segment), addr.Address)
+}
+
+type OperandFarAddress struct {
+	Segment uint16
+	Offset  uint16
+}
+
+func (addr OperandFarAddress) String() string {
+	return fmt.Sprintf("%d:%d", addr.Segment, addr.Offset)
 }
 
 type OperandEffectiveAddress struct {
-	Base string
-	Disp int16
-	Wide bool
+	Base    string
+	Disp    int16
+	Wide    bool
+	Segment string // override prefix, empty for the default
 }
 
 func (ea OperandEffectiveAddress) String() string {
-	return fmt.Sprintf("[%s%+d]", ea.Base, ea.Disp)
+	return fmt.Sprintf("%s[%s%+d]", segmentPrefix(ea.Segment), ea.Base, ea.Disp)
+}
+
+func segmentPrefix(segment string) string {
+	if segment == "" {
+		return ""
+	}
+
+	return segment + ":"
 }
 
 type Instruction struct {
 	Op       string
 	Size     int
 	Operands [2]Operand
+	Wide     bool
+
+	Lock    bool
+	Rep     string // "rep" or "repne"
+	Segment string // segment override prefix
+	Far     bool   // intersegment call or jump
+
+	// iterations a repeated string instruction or shift ran for, known after
+	// execution
+	Repetitions int
+
+	// wait states devices added to in or out, known after execution
+	Waits int
+
+	// conditional jump or into went ahead, known after execution
+	Taken bool
 }
 
 func (inst Instruction) String() string {
+	name := inst.Op
+	if isStringOp(inst.Op) {
+		if inst.Wide {
+			name += "w"
+		} else {
+			name += "b"
+		}
+	}
+
+	if inst.Rep != "" {
+		rep := inst.Rep
+		if rep == "rep" && (inst.Op == "cmps" || inst.Op == "scas") {
+			rep = "repe"
+		}
+
+		name = rep + " " + name
+	}
+
+	if inst.Lock {
+		name = "lock " + name
+	}
+
+	// with no memory operand to carry it the override goes in front
+	if inst.Segment != "" && !isMemoryOperand(inst.Operands[0]) && !isMemoryOperand(inst.Operands[1]) {
+		name = inst.Segment + " " + name
+	}
+
 	var stringOperands []string
 	for _, op := range inst.Operands {
 		if op != nil {
@@ -289,5 +495,48 @@ func (inst Instruction) String() string {
 		}
 	}
 
-	return fmt.Sprintf("%s %s", inst.Op, strings.Join(stringOperands, ", "))
+	if len(stringOperands) == 0 {
+		return name
+	}
+
+	// memory needs an explicit size unless the other operand implies it
+	if isMemoryOperand(inst.Operands[0]) && (inst.Operands[1] == nil || isShift(inst.Op)) {
+		size := "byte"
+		if inst.Far {
+			size = "far"
+		} else if inst.Wide {
+			size = "word"
+		}
+
+		stringOperands[0] = size + " " + stringOperands[0]
+	}
+
+	return fmt.Sprintf("%s %s", name, strings.Join(stringOperands, ", "))
+}
+
+func isStringOp(op string) bool {
+	switch op {
+	case "movs", "cmps", "scas", "lods", "stos":
+		return true
+	}
+
+	return false
+}
+
+func isShift(op string) bool {
+	switch op {
+	case "shl", "shr", "sar", "rol", "ror", "rcl", "rcr":
+		return true
+	}
+
+	return false
+}
+
+func isMemoryOperand(op Operand) bool {
+	switch op.(type) {
+	case OperandDirectAddress, OperandEffectiveAddress:
+		return true
+	}
+
+	return false
 }
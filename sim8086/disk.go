@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const SectorSize = 512
+
+// Disk is a floppy or hard disk image the BIOS reads sectors from. Writes are
+// refused, the image file is never changed.
+type Disk struct {
+	Data  []byte
+	Drive byte // 00h for the first floppy, 80h for the first hard disk
+
+	Cylinders, Heads, Sectors int
+
+	status byte // result of the last operation, for ah=01h
+}
+
+// BIOS disk status codes
+const (
+	diskOk             = 0x00
+	diskBadCommand     = 0x01
+	diskWriteProtected = 0x03
+	diskSectorNotFound = 0x04
+	diskNotReady       = 0x80
+)
+
+// NewDisk picks the geometry from the image size: the standard floppy
+// formats, anything else is a hard disk with 16 heads of 63 sectors.
+func NewDisk(data []byte) *Disk {
+	floppies := map[int][3]int{
+		160:  {40, 1, 8},
+		180:  {40, 1, 9},
+		320:  {40, 2, 8},
+		360:  {40, 2, 9},
+		720:  {80, 2, 9},
+		1200: {80, 2, 15},
+		1440: {80, 2, 18},
+		2880: {80, 2, 36},
+	}
+
+	if len(data)%1024 == 0 {
+		if geometry, ok := floppies[len(data)/1024]; ok {
+			cylinders, heads, sectors := geometry[0], geometry[1], geometry[2]
+			return &Disk{Data: data, Drive: 0x00, Cylinders: cylinders, Heads: heads, Sectors: sectors}
+		}
+	}
+
+	cylinders := max((len(data)+16*63*SectorSize-1)/(16*63*SectorSize), 1)
+	return &Disk{Data: data, Drive: 0x80, Cylinders: cylinders, Heads: 16, Sectors: 63}
+}
+
+// InstallDisk answers int 13h for the disk.
+func InstallDisk(disk *Disk) {
+	InterruptHandlers[0x13] = disk.Service
+}
+
+// LoadBoot loads the boot sector at segment:offset and starts it like the
+// BIOS does, with the boot drive in dl.
+func LoadBoot(disk *Disk, memory Memory, registers Registers,
+	segment, offset uint16) (Image, error) {
+	if len(disk.Data) < SectorSize {
+		return Image{}, fmt.Errorf("disk image is shorter than a sector")
+	}
+
+	boot := disk.Data[:SectorSize]
+	if boot[510] != 0x55 || boot[511] != 0xaa {
+		return Image{}, fmt.Errorf("boot sector has no 55aah signature")
+	}
+
+	image := LoadRaw(boot, memory, registers, segment, offset)
+
+	registers[RI_d] = int16(disk.Drive)
+	registers[RI_ds] = 0
+	registers[RI_es] = 0
+	registers[RI_ss] = 0
+	registers[RI_sp] = 0x7c00
+
+	return image, nil
+}
+
+// Service is the int 13h handler, function in ah and drive in dl. Status
+// goes in ah with carry set on failure.
+func (disk *Disk) Service(registers Registers, memory Memory) error {
+	a := uint16(registers[RI_a])
+	c := uint16(registers[RI_c])
+	d := uint16(registers[RI_d])
+
+	ah := byte(a >> 8)
+
+	if byte(d) != disk.Drive && ah != 0x00 {
+		return disk.finish(diskNotReady, registers, memory)
+	}
+
+	switch ah {
+	case 0x00: // reset
+		return disk.finish(diskOk, registers, memory)
+
+	case 0x01: // status of the last operation
+		setHigh(registers, RI_a, disk.status)
+		SetReturnFlag(RF_carry, disk.status != diskOk, registers, memory)
+
+	case 0x02: // read al sectors from cylinder ch (+ cl bits 6-7), head dh, sector cl
+		cylinder := int(c>>8) | int(c&0xc0)<<2
+		head := int(d >> 8)
+		sector := int(c & 0x3f)
+
+		if sector == 0 || sector > disk.Sectors || head >= disk.Heads || cylinder >= disk.Cylinders {
+			setLow(registers, RI_a, 0)
+			return disk.finish(diskSectorNotFound, registers, memory)
+		}
+
+		lba := (cylinder*disk.Heads+head)*disk.Sectors + sector - 1
+		count := disk.read(lba, int(byte(a)), uint16(registers[RI_es]), uint16(registers[RI_b]), memory)
+		setLow(registers, RI_a, byte(count))
+
+		if count < int(byte(a)) {
+			return disk.finish(diskSectorNotFound, registers, memory)
+		}
+		return disk.finish(diskOk, registers, memory)
+
+	case 0x03, 0x43: // write
+		setLow(registers, RI_a, 0)
+		return disk.finish(diskWriteProtected, registers, memory)
+
+	case 0x08: // drive parameters: last cylinder, head and sector, drive count
+		last := disk.Cylinders - 1
+		registers[RI_c] = int16(uint16(last&0xff)<<8 | uint16(last>>8&3)<<6 | uint16(disk.Sectors))
+		registers[RI_d] = int16(uint16(disk.Heads-1)<<8 | 1)
+		if disk.Drive < 0x80 {
+			setLow(registers, RI_b, disk.floppyType())
+		}
+		return disk.finish(diskOk, registers, memory)
+
+	case 0x15: // disk type, with the sector count in cx:dx for hard disks
+		if disk.Drive < 0x80 {
+			disk.finish(diskOk, registers, memory)
+			setHigh(registers, RI_a, 0x01) // floppy without change line
+			break
+		}
+
+		total := disk.Cylinders * disk.Heads * disk.Sectors
+		registers[RI_c] = int16(total >> 16)
+		registers[RI_d] = int16(total)
+		disk.finish(diskOk, registers, memory)
+		setHigh(registers, RI_a, 0x03)
+
+	case 0x41: // extensions present when bx is 55aah
+		if uint16(registers[RI_b]) != 0x55aa || disk.Drive < 0x80 {
+			return disk.finish(diskBadCommand, registers, memory)
+		}
+
+		setHigh(registers, RI_b, 0xaa)
+		setLow(registers, RI_b, 0x55)
+		registers[RI_c] = 0x0001 // extended disk access functions
+		disk.finish(diskOk, registers, memory)
+		setHigh(registers, RI_a, 0x01) // version 1.x
+
+	case 0x42: // extended read, disk address packet at ds:si
+		ds := uint16(registers[RI_ds])
+		si := uint16(registers[RI_si])
+
+		packet := make([]byte, 16)
+		for i := range packet {
+			packet[i] = byte(memory.Load(ds, si+uint16(i), false))
+		}
+
+		requested := int(binary.LittleEndian.Uint16(packet[2:]))
+		offset := binary.LittleEndian.Uint16(packet[4:])
+		segment := binary.LittleEndian.Uint16(packet[6:])
+		lba := binary.LittleEndian.Uint64(packet[8:])
+
+		if lba >= uint64(len(disk.Data)/SectorSize) {
+			memory.Store(ds, si+2, 0, true)
+			return disk.finish(diskSectorNotFound, registers, memory)
+		}
+
+		count := disk.read(int(lba), requested, segment, offset, memory)
+		memory.Store(ds, si+2, uint16(count), true)
+
+		if count < requested {
+			return disk.finish(diskSectorNotFound, registers, memory)
+		}
+		return disk.finish(diskOk, registers, memory)
+
+	default:
+		return disk.finish(diskBadCommand, registers, memory)
+	}
+
+	return nil
+}
+
+// read copies up to count sectors starting at lba into memory at
+// segment:offset and returns how many were there to read.
+func (disk *Disk) read(lba, count int, segment, offset uint16, memory Memory) int {
+	for i := range count {
+		start := (lba + i) * SectorSize
+		if start+SectorSize > len(disk.Data) {
+			return i
+		}
+
+		for _, b := range disk.Data[start : start+SectorSize] {
+			memory.Store(segment, offset, uint16(b), false)
+			offset++
+		}
+	}
+
+	return count
+}
+
+// finish records the status, returns it in ah and sets carry on failure.
+func (disk *Disk) finish(status byte, registers Registers, memory Memory) error {
+	disk.status = status
+	setHigh(registers, RI_a, status)
+	SetReturnFlag(RF_carry, status != diskOk, registers, memory)
+
+	return nil
+}
+
+// floppyType is the CMOS drive type reported by ah=08h.
+func (disk *Disk) floppyType() byte {
+	switch disk.Sectors {
+	case 8, 9:
+		if disk.Cylinders == 80 {
+			return 3 // 720K
+		}
+		return 1 // 360K
+	case 15:
+		return 2 // 1.2M
+	case 18:
+		return 4 // 1.44M
+	}
+
+	return 6 // 2.88M
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sandbox is the host directory DOS file names are resolved in. Without one
+// every file call fails with access denied.
+var Sandbox string
+
+// open host files by DOS handle, 0-4 are the standard devices
+var dosFiles = map[uint16]*os.File{}
+
+const firstFileHandle = 5
+
+// DOS error codes returned in ax with carry set
+const (
+	dosInvalidFunction  = 1
+	dosFileNotFound     = 2
+	dosPathNotFound     = 3
+	dosTooManyOpenFiles = 4
+	dosAccessDenied     = 5
+	dosInvalidHandle    = 6
+)
+
+// InstallDos sets up the vector table and the DOS services the simulator
+// provides itself.
+func InstallDos(memory Memory) {
+	InstallBios(memory)
+
+	InterruptHandlers[0x20] = dosTerminate
+	InterruptHandlers[0x21] = dosService
+}
+
+// int 20h - terminate program
+func dosTerminate(registers Registers, memory Memory) error {
+	return ProgramExit{0}
+}
+
+// int 21h - the function number is in ah
+func dosService(registers Registers, memory Memory) error {
+	ds := uint16(registers[RI_ds])
+	dx := uint16(registers[RI_d])
+	al := byte(registers[RI_a])
+
+	switch ah := byte(uint16(registers[RI_a]) >> 8); ah {
+	case 0x00: // terminate program
+		return ProgramExit{0}
+
+	case 0x01: // read character with echo
+		char := readConsole()
+		Teletype([]byte{char}, memory)
+		setLow(registers, RI_a, char)
+
+	case 0x02: // write character in dl
+		Teletype([]byte{byte(dx)}, memory)
+		setLow(registers, RI_a, byte(dx))
+
+	case 0x06: // direct console i/o, dl = ffh reads without waiting
+		if byte(dx) != 0xff {
+			Teletype([]byte{byte(dx)}, memory)
+			setLow(registers, RI_a, byte(dx))
+			break
+		}
+
+		// zero set and al 0 when no key has been typed
+		char, ok := ConsoleInput.Peek()
+		if ok {
+			ConsoleInput.Read()
+		}
+		setLow(registers, RI_a, char)
+		SetReturnFlag(RF_zero, !ok, registers, memory)
+
+	case 0x07, 0x08: // read character without echo
+		setLow(registers, RI_a, readConsole())
+
+	case 0x09: // write string at ds:dx up to '$'
+		var text []byte
+		for offset := dx; ; offset++ {
+			char := byte(memory.Load(ds, offset, false))
+			if char == '$' {
+				break
+			}
+
+			// the whole segment went by without one
+			if len(text) == 0xffff {
+				return fmt.Errorf("string at %04x:%04x has no '$' terminator", ds, dx)
+			}
+
+			text = append(text, char)
+		}
+
+		Teletype(text, memory)
+		setLow(registers, RI_a, '$')
+
+	case 0x25: // set interrupt vector al to ds:dx
+		memory.Store(0, uint16(al)*4, dx, true)
+		memory.Store(0, uint16(al)*4+2, ds, true)
+
+	case 0x35: // get interrupt vector al into es:bx
+		registers[RI_b] = int16(memory.Load(0, uint16(al)*4, true))
+		registers[RI_es] = int16(memory.Load(0, uint16(al)*4+2, true))
+
+	case 0x3c: // create or truncate file named at ds:dx
+		return dosOpen(readAsciiz(memory, ds, dx), os.O_RDWR|os.O_CREATE|os.O_TRUNC, registers, memory)
+
+	case 0x3d: // open file named at ds:dx, access mode in al
+		flags := []int{os.O_RDONLY, os.O_WRONLY, os.O_RDWR}
+		if al&7 > 2 {
+			return dosFail(dosInvalidFunction, registers, memory)
+		}
+		return dosOpen(readAsciiz(memory, ds, dx), flags[al&7], registers, memory)
+
+	case 0x3e: // close handle bx
+		handle := uint16(registers[RI_b])
+		file, ok := dosFiles[handle]
+		if !ok {
+			return dosFail(dosInvalidHandle, registers, memory)
+		}
+
+		file.Close()
+		delete(dosFiles, handle)
+		SetReturnFlag(RF_carry, false, registers, memory)
+
+	case 0x3f, 0x40: // read from or write to handle bx, cx bytes at ds:dx
+		reader, writer := dosHandle(uint16(registers[RI_b]), memory)
+		count := uint16(registers[RI_c])
+		buffer := make([]byte, count)
+
+		var n int
+		var err error
+		if ah == 0x3f {
+			if reader == nil {
+				return dosFail(dosInvalidHandle, registers, memory)
+			}
+
+			// the console gives back a line, files as much as was asked for
+			if _, ok := reader.(consoleReader); ok {
+				n, err = reader.Read(buffer)
+			} else {
+				n, err = io.ReadFull(reader, buffer)
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				err = nil
+			}
+			for i := range n {
+				memory.Store(ds, dx+uint16(i), uint16(buffer[i]), false)
+			}
+		} else {
+			if writer == nil {
+				return dosFail(dosInvalidHandle, registers, memory)
+			}
+
+			for i := range buffer {
+				buffer[i] = byte(memory.Load(ds, dx+uint16(i), false))
+			}
+			n, err = writer.Write(buffer)
+		}
+
+		if err != nil {
+			return dosFail(dosAccessDenied, registers, memory)
+		}
+
+		registers[RI_a] = int16(n)
+		SetReturnFlag(RF_carry, false, registers, memory)
+
+	case 0x4c: // terminate with exit code in al
+		return ProgramExit{al}
+
+	default:
+		return fmt.Errorf("unsupported dos function %02xh", ah)
+	}
+
+	return nil
+}
+
+// dosHandle maps a DOS handle onto the host; console handles only go one way.
+func dosHandle(handle uint16, memory Memory) (io.Reader, io.Writer) {
+	switch handle {
+	case 0:
+		return consoleReader{}, nil
+	case 1, 2:
+		return nil, teletypeWriter{memory}
+	}
+
+	if file, ok := dosFiles[handle]; ok {
+		return file, file
+	}
+
+	return nil, nil
+}
+
+// dosOpen opens a file inside the sandbox and returns its handle in ax.
+func dosOpen(name string, flags int, registers Registers, memory Memory) error {
+	path, ok := sandboxPath(name)
+	if !ok {
+		return dosFail(dosAccessDenied, registers, memory)
+	}
+
+	handle := uint16(firstFileHandle)
+	for dosFiles[handle] != nil {
+		handle++
+	}
+	if handle > 0xff {
+		return dosFail(dosTooManyOpenFiles, registers, memory)
+	}
+
+	file, err := os.OpenFile(path, flags, 0o644)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if _, statErr := os.Stat(filepath.Dir(path)); statErr != nil {
+			return dosFail(dosPathNotFound, registers, memory)
+		}
+		return dosFail(dosFileNotFound, registers, memory)
+	case err != nil:
+		return dosFail(dosAccessDenied, registers, memory)
+	}
+
+	dosFiles[handle] = file
+	registers[RI_a] = int16(handle)
+	SetReturnFlag(RF_carry, false, registers, memory)
+
+	return nil
+}
+
+// sandboxPath turns a DOS path like C:\DATA\IN.TXT into a host path under the
+// sandbox, refusing anything that would leave it.
+func sandboxPath(name string) (string, bool) {
+	if Sandbox == "" {
+		return "", false
+	}
+
+	if len(name) >= 2 && name[1] == ':' {
+		name = name[2:]
+	}
+	name = strings.TrimLeft(strings.ReplaceAll(name, `\`, "/"), "/")
+
+	if !filepath.IsLocal(name) {
+		return "", false
+	}
+
+	return filepath.Join(Sandbox, filepath.FromSlash(name)), true
+}
+
+// dosFail reports a DOS error the usual way: code in ax and carry set.
+func dosFail(code int16, registers Registers, memory Memory) error {
+	registers[RI_a] = code
+	SetReturnFlag(RF_carry, true, registers, memory)
+
+	return nil
+}
+
+// readConsole returns the next input character, ^Z once input runs out.
+func readConsole() byte {
+	char, ok := ConsoleInput.Read()
+	if !ok {
+		return 0x1a
+	}
+
+	return char
+}
+
+func readAsciiz(memory Memory, segment, offset uint16) string {
+	var text []byte
+	for {
+		char := byte(memory.Load(segment, offset, false))
+		if char == 0 || len(text) == 0xffff {
+			return string(text)
+		}
+
+		text = append(text, char)
+		offset++
+	}
+}
+
+// consoleReader reads handle 0 from the keyboard a line at a time, like
+// DOS does, ending it with CR LF however the host ended it.
+type consoleReader struct{}
+
+func (consoleReader) Read(buffer []byte) (int, error) {
+	n := 0
+	for n < len(buffer) {
+		char, ok := ConsoleInput.Read()
+		if !ok {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+
+		if char == '\n' && (n == 0 || buffer[n-1] != '\r') {
+			switch {
+			case n+2 <= len(buffer):
+				buffer[n] = '\r'
+				n++
+			case n > 0:
+				// no room for both, so the line ends on the next read
+				ConsoleInput.Unread(char)
+				return n, nil
+			}
+		}
+
+		buffer[n] = char
+		n++
+
+		if char == '\n' {
+			break
+		}
+	}
+
+	return n, nil
+}
+
+// teletypeWriter sends handle output through the BIOS like DOS does.
+type teletypeWriter struct {
+	memory Memory
+}
+
+func (writer teletypeWriter) Write(text []byte) (int, error) {
+	Teletype(text, writer.memory)
+	return len(text), nil
+}
+
+// LowestPspSegment keeps a PSP, and the environment 0x10 paragraphs below it,
+// clear of the vector table and the BIOS data area.
+const LowestPspSegment = 0x60
+
+// BuildPsp lays out the 256-byte program segment prefix DOS places in front
+// of every program, with the command tail taken from arguments.
+func BuildPsp(memory Memory, segment uint16, program string, arguments string) {
+	for offset := range uint16(0x100) {
+		memory.Store(segment, offset, 0, false)
+	}
+
+	memory.Store(segment, 0x00, 0x20cd, true) // int 20h
+	memory.Store(segment, 0x02, 0xa000, true) // end of conventional memory
+
+	// terminate, ctrl-break and critical error addresses copied from the
+	// vector table, restored by DOS when the program exits
+	for i, vector := range []uint16{0x22, 0x23, 0x24} {
+		memory.Store(segment, 0x0a+uint16(i)*4, memory.Load(0, vector*4, true), true)
+		memory.Store(segment, 0x0c+uint16(i)*4, memory.Load(0, vector*4+2, true), true)
+	}
+
+	environment := segment - 0x10
+	buildEnvironment(memory, environment, program)
+	memory.Store(segment, 0x2c, environment, true)
+
+	// far call entry to dos: int 21h, retf
+	memory.Store(segment, 0x50, 0xcd, false)
+	memory.Store(segment, 0x51, 0x21, false)
+	memory.Store(segment, 0x52, 0xcb, false)
+
+	// command tail keeps the separating space and ends with a carriage return
+	tail := ""
+	if arguments != "" {
+		tail = " " + arguments
+	}
+	if len(tail) > 126 {
+		tail = tail[:126]
+	}
+
+	memory.Store(segment, 0x80, uint16(len(tail)), false)
+	for i := range len(tail) {
+		memory.Store(segment, 0x81+uint16(i), uint16(tail[i]), false)
+	}
+	memory.Store(segment, 0x81+uint16(len(tail)), '\r', false)
+}
+
+// buildEnvironment writes an empty environment followed by the program path,
+// which is where programs look up their own name.
+func buildEnvironment(memory Memory, segment uint16, program string) {
+	path := `C:\` + strings.ToUpper(filepath.Base(program)) + "\x00"
+	block := "\x00\x00\x01\x00" + path
+
+	for i := range len(block) {
+		memory.Store(segment, uint16(i), uint16(block[i]), false)
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"slices"
+	"strings"
+)
 
-type Memory []byte
 type Registers []int16
 
-func ExecuteIntruction(inst Instruction, registers Registers, memory Memory) {
+// Trace receives what each instruction did, written out in TraceFormat.
+var Trace io.Writer = os.Stdout
+
+func ExecuteIntruction(inst *Instruction, registers Registers, memory Memory) error {
 	dest := inst.Operands[0]
 	source := inst.Operands[1]
+	wide := inst.Wide
 
 	var left int16
 	var right int16
@@ -19,45 +29,342 @@ func ExecuteIntruction(inst Instruction, registers Registers, memory Memory) {
 		right = GetOperandValue(source, registers, memory)
 	}
 
+	TraceOperands(inst, left, right)
+
+	before := slices.Clone(registers)
+
+	var err error
+
 	switch inst.Op {
 	case "mov":
 		SetOperandValue(dest, right, registers, memory)
 
 	case "add":
-		value := left + right
+		value := Add(left, right, false, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "adc":
+		value := Add(left, right, GetFlag(registers, RF_carry), wide, registers)
 		SetOperandValue(dest, value, registers, memory)
-		UpdateFlagsRegister(value, registers)
 
 	case "sub":
-		value := left - right
+		value := Sub(left, right, false, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "sbb":
+		value := Sub(left, right, GetFlag(registers, RF_carry), wide, registers)
 		SetOperandValue(dest, value, registers, memory)
-		UpdateFlagsRegister(value, registers)
 
 	case "cmp":
-		value := left - right
-		UpdateFlagsRegister(value, registers)
+		Sub(left, right, false, wide, registers)
 
-	case "jne":
-		isZero := registers[RI_flags]&(1<<RF_zero) == (1 << RF_zero)
-		if !isZero {
-			registers[RI_ip] += int16(int8(right))
+	case "inc", "dec":
+		// carry is left untouched by inc and dec
+		carry := GetFlag(registers, RF_carry)
+
+		var value int16
+		if inst.Op == "inc" {
+			value = Add(left, 1, false, wide, registers)
+		} else {
+			value = Sub(left, 1, false, wide, registers)
+		}
+
+		SetFlag(registers, RF_carry, carry)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "neg":
+		value := Sub(0, left, false, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "mul", "imul":
+		Multiply(left, inst.Op == "imul", wide, registers)
+
+	case "div", "idiv":
+		if !Divide(left, inst.Op == "idiv", wide, registers) {
+			TraceFault("divide error")
+			err = Interrupt(0, registers, memory)
+		}
+
+	case "lea":
+		_, offset := ResolveAddress(source, registers)
+		SetOperandValue(dest, int16(offset), registers, memory)
+
+	case "lds", "les":
+		segment, offset := ResolveAddress(source, registers)
+		SetOperandValue(dest, right, registers, memory)
+
+		if inst.Op == "lds" {
+			registers[RI_ds] = int16(memory.Load(segment, offset+2, true))
+		} else {
+			registers[RI_es] = int16(memory.Load(segment, offset+2, true))
+		}
+
+	case "xlat":
+		segment := uint16(registers[SegmentRegisterIndex(inst.Segment)])
+		offset := uint16(registers[RI_b]) + uint16(registers[RI_a]&0xff)
+		registers[RI_a] = registers[RI_a]&^0xff | int16(memory.Load(segment, offset, false))
+
+	case "xchg":
+		SetOperandValue(dest, right, registers, memory)
+		SetOperandValue(source, left, registers, memory)
+
+	case "cbw":
+		registers[RI_a] = int16(int8(registers[RI_a]))
+
+	case "cwd":
+		registers[RI_d] = registers[RI_a] >> 15
+
+	case "and":
+		value := Logic(left&right, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "or":
+		value := Logic(left|right, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "xor":
+		value := Logic(left^right, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "test":
+		Logic(left&right, wide, registers)
+
+	case "not":
+		SetOperandValue(dest, ^left, registers, memory)
+
+	case "shl", "shr", "sar", "rol", "ror", "rcl", "rcr":
+		inst.Repetitions = int(uint8(right))
+		value := Shift(inst.Op, left, inst.Repetitions, wide, registers)
+		SetOperandValue(dest, value, registers, memory)
+
+	case "movs", "cmps", "scas", "lods", "stos":
+		inst.Repetitions = RepeatString(inst, registers, memory)
+
+	case "in":
+		value, waits := Ports.In(uint16(right), wide)
+		inst.Waits = waits
+		SetOperandValue(dest, int16(value), registers, memory)
+
+	case "out":
+		inst.Waits = Ports.Out(uint16(left), uint16(right), wide)
+
+	case "cld":
+		SetFlag(registers, RF_direction, false)
+
+	case "std":
+		SetFlag(registers, RF_direction, true)
+
+	case "push":
+		// push sp stores the already decremented value on the 8086
+		if reg, ok := dest.(OperandRegister); ok && reg.Index == RI_sp {
+			left -= 2
+		}
+		Push(left, registers, memory)
+
+	case "pop":
+		SetOperandValue(dest, Pop(registers, memory), registers, memory)
+
+	case "pushf":
+		Push(FlagsImage(registers), registers, memory)
+
+	case "popf":
+		LoadFlags(registers, Pop(registers, memory))
+
+	case "lahf":
+		registers[RI_a] = registers[RI_a]&0xff | (FlagsImage(registers)&0xff)<<8
+
+	case "sahf":
+		// only the low byte is replaced, tf, if, df and of stay
+		low := int16(uint16(registers[RI_a]) >> 8)
+		LoadFlags(registers, registers[RI_flags]&^0xff|low)
+
+	case "clc":
+		SetFlag(registers, RF_carry, false)
+
+	case "stc":
+		SetFlag(registers, RF_carry, true)
+
+	case "cmc":
+		SetFlag(registers, RF_carry, !GetFlag(registers, RF_carry))
+
+	case "cli":
+		SetFlag(registers, RF_interrupt, false)
+
+	case "sti":
+		SetFlag(registers, RF_interrupt, true)
+
+	case "hlt":
+		err = ErrHalt
+
+	case "call", "jmp":
+		if inst.Op == "call" && inst.Far {
+			Push(registers[RI_cs], registers, memory)
+		}
+		if inst.Op == "call" {
+			Push(registers[RI_ip], registers, memory)
+		}
+
+		switch target := dest.(type) {
+		case nil:
+			JumpRelative(source, registers)
+
+		case OperandFarAddress:
+			registers[RI_cs] = int16(target.Segment)
+			registers[RI_ip] = int16(target.Offset)
+
+		default:
+			if inst.Far {
+				segment, offset := ResolveAddress(target, registers)
+				registers[RI_ip] = int16(memory.Load(segment, offset, true))
+				registers[RI_cs] = int16(memory.Load(segment, offset+2, true))
+			} else {
+				registers[RI_ip] = left
+			}
+		}
+
+	case "ret", "retf":
+		registers[RI_ip] = Pop(registers, memory)
+		if inst.Op == "retf" {
+			registers[RI_cs] = Pop(registers, memory)
+		}
+
+		// ret n also releases n bytes of arguments
+		registers[RI_sp] += right
+
+	case "int":
+		err = Interrupt(byte(right), registers, memory)
+
+	case "int3":
+		err = Interrupt(3, registers, memory)
+
+	case "into":
+		inst.Taken = GetFlag(registers, RF_overflow)
+		if inst.Taken {
+			err = Interrupt(4, registers, memory)
+		}
+
+	case "iret":
+		registers[RI_ip] = Pop(registers, memory)
+		registers[RI_cs] = Pop(registers, memory)
+		LoadFlags(registers, Pop(registers, memory))
+
+	case "jo", "jno", "jb", "jnb", "jz", "jne", "jbe", "ja",
+		"js", "jns", "jp", "jnp", "jl", "jnl", "jle", "jg":
+		inst.Taken = JumpCondition(inst.Op, registers)
+		if inst.Taken {
+			JumpRelative(source, registers)
+		}
+
+	case "loop", "loopz", "loopnz":
+		registers[RI_c]--
+
+		taken := registers[RI_c] != 0
+		if inst.Op == "loopz" {
+			taken = taken && GetFlag(registers, RF_zero)
+		} else if inst.Op == "loopnz" {
+			taken = taken && !GetFlag(registers, RF_zero)
+		}
+
+		inst.Taken = taken
+		if taken {
+			JumpRelative(source, registers)
+		}
+
+	case "jcxz":
+		inst.Taken = registers[RI_c] == 0
+		if inst.Taken {
+			JumpRelative(source, registers)
 		}
 	}
 
-	if dest != nil {
-		before := left
-		after := GetOperandValue(dest, registers, memory)
+	// an out to a fixed port has no destination to show
+	if _, port := dest.(OperandImmediate); dest != nil && !port {
+		TraceResult(GetOperandValue(dest, registers, memory))
+	}
 
-		fmt.Printf("; %s 0x%04x->0x%04x\n", dest.String(), before, after)
+	// trap flag raises interrupt 1 after every instruction it was set for
+	if err == nil && before[RI_flags]&(1<<RF_trap) != 0 {
+		err = Interrupt(1, registers, memory)
 	}
 
-	return
+	return err
+}
+
+// JumpCondition evaluates the flags tested by a conditional jump.
+func JumpCondition(op string, registers Registers) bool {
+	carry := GetFlag(registers, RF_carry)
+	zero := GetFlag(registers, RF_zero)
+	sign := GetFlag(registers, RF_sign)
+	overflow := GetFlag(registers, RF_overflow)
+	parity := GetFlag(registers, RF_parity)
+
+	switch op {
+	case "jo":
+		return overflow
+	case "jno":
+		return !overflow
+	case "jb":
+		return carry
+	case "jnb":
+		return !carry
+	case "jz":
+		return zero
+	case "jne":
+		return !zero
+	case "jbe":
+		return carry || zero
+	case "ja":
+		return !carry && !zero
+	case "js":
+		return sign
+	case "jns":
+		return !sign
+	case "jp":
+		return parity
+	case "jnp":
+		return !parity
+	case "jl":
+		return sign != overflow
+	case "jnl":
+		return sign == overflow
+	case "jle":
+		return zero || sign != overflow
+	case "jg":
+		return !zero && sign == overflow
+	}
+
+	return false
+}
+
+// JumpRelative moves ip by a short (byte) or near (word) displacement.
+func JumpRelative(displacement Operand, registers Registers) {
+	imm := displacement.(OperandImmediate)
+	if imm.Wide {
+		registers[RI_ip] += int16(imm.Value)
+	} else {
+		registers[RI_ip] += int16(int8(imm.Value))
+	}
 }
 
 func GetRegisterValue(operand OperandRegister, registers Registers) int16 {
-	// only wide registers
-	// TODO: support _h _l registers
-	return registers[operand.Index]
+	value := registers[operand.Index]
+	if operand.Size == 2 {
+		return value
+	}
+
+	// byte registers: offset 0 is the low half (al), 1 the high half (ah)
+	return int16((uint16(value) >> (8 * operand.Offset)) & 0xff)
+}
+
+func SetRegisterValue(operand OperandRegister, value int16, registers Registers) {
+	if operand.Size == 2 {
+		registers[operand.Index] = value
+		return
+	}
+
+	shift := 8 * operand.Offset
+	mask := int16(0xff) << shift
+	registers[operand.Index] = registers[operand.Index]&^mask | (value<<shift)&mask
 }
 
 func GetOperandValue(operand Operand, registers Registers, memory Memory) int16 {
@@ -68,20 +375,9 @@ func GetOperandValue(operand Operand, registers Registers, memory Memory) int16
 	case OperandRegister:
 		return GetRegisterValue(op, registers)
 
-	case OperandDirectAddress:
-		lo := memory[op]
-		hi := memory[op+1]
-		return (int16(hi) << 8) | int16(lo)
-
-	case OperandEffectiveAddress:
-		ea := EvalEffectiveAddress(op, registers, memory)
-		if op.Wide {
-			lo := memory[ea]
-			hi := memory[ea+1]
-			return (int16(hi) << 8) | int16(lo)
-		}
-
-		return int16(memory[ea])
+	case OperandDirectAddress, OperandEffectiveAddress:
+		segment, offset := ResolveAddress(op, registers)
+		return int16(memory.Load(segment, offset, isWideMemory(op)))
 	}
 
 	return 0
@@ -90,21 +386,26 @@ func GetOperandValue(operand Operand, registers Registers, memory Memory) int16
 func SetOperandValue(operand Operand, value int16, registers Registers, memory Memory) {
 	switch op := operand.(type) {
 	case OperandRegister:
-		// only wide registers
-		registers[op.Index] = value
+		SetRegisterValue(op, value, registers)
 
-	case OperandDirectAddress:
-		memory[op] = byte(0x0f & value)
-		memory[op+1] = byte(value >> 8)
+	case OperandDirectAddress, OperandEffectiveAddress:
+		segment, offset := ResolveAddress(op, registers)
+		memory.Store(segment, offset, uint16(value), isWideMemory(op))
+	}
+}
 
+func isWideMemory(op Operand) bool {
+	switch op := op.(type) {
+	case OperandDirectAddress:
+		return op.Wide
 	case OperandEffectiveAddress:
-		ea := EvalEffectiveAddress(op, registers, memory)
-		memory[ea] = byte(0xff & value)
-		memory[ea+1] = byte(value >> 8)
+		return op.Wide
 	}
+
+	return false
 }
 
-func EvalEffectiveAddress(op OperandEffectiveAddress, registers Registers, memory Memory) int16 {
+func EvalEffectiveAddress(op OperandEffectiveAddress, registers Registers) uint16 {
 	var address int16
 
 	bx := OperandRegister{RI_b, 0, 2}
@@ -131,30 +432,67 @@ func EvalEffectiveAddress(op OperandEffectiveAddress, registers Registers, memor
 		address = GetRegisterValue(bx, registers)
 	}
 
-	return address + op.Disp
+	return uint16(address + op.Disp)
 }
 
 func PrintFlags(flags int16) {
+	fmt.Fprintf(Trace, "; Flags: %s\n", FlagLetters(flags))
+}
+
+// FlagLetters lists the flags set, like "CZ".
+func FlagLetters(flags int16) string {
 	strFlags := [RF_Count]string{
-		RF_zero: "Z",
-		RF_sign: "S",
+		RF_carry:     "C",
+		RF_parity:    "P",
+		RF_aux:       "A",
+		RF_zero:      "Z",
+		RF_sign:      "S",
+		RF_trap:      "T",
+		RF_interrupt: "I",
+		RF_direction: "D",
+		RF_overflow:  "O",
 	}
 
-	fmt.Print("; Flags: ")
+	var letters strings.Builder
 	for i, f := range strFlags {
 		if flags&(1<<i) == (1 << i) {
-			fmt.Print(f)
+			letters.WriteString(f)
 		}
 	}
-	fmt.Println()
+
+	return letters.String()
 }
 
-func UpdateFlagsRegister(value int16, registers Registers) {
-	registers[RI_flags] &= 0
-	registers[RI_flags] |= BoolToInt(value == 0) << RF_zero
-	registers[RI_flags] |= BoolToInt(value < 0) << RF_sign
+func UpdateFlagsRegister(value int16, wide bool, registers Registers) {
+	result := uint32(uint16(value)) & widthMask(wide)
 
-	PrintFlags(registers[RI_flags])
+	SetFlag(registers, RF_zero, result == 0)
+	SetFlag(registers, RF_sign, result&signBit(wide) != 0)
+	SetFlag(registers, RF_parity, bits.OnesCount8(uint8(result))%2 == 0)
+
+	TraceFlags(registers)
+}
+
+// definedFlags masks the nine flags the 8086 implements
+const definedFlags = 0x0fd5
+
+// FlagsImage is the flags register as pushf and lahf see it, with the
+// undefined bits reading back the way they do on an 8086.
+func FlagsImage(registers Registers) int16 {
+	return int16(uint16(registers[RI_flags]) | 0xf002)
+}
+
+func LoadFlags(registers Registers, value int16) {
+	registers[RI_flags] = value & definedFlags
+}
+
+func GetFlag(registers Registers, flag RegisterFlag) bool {
+	return registers[RI_flags]&(1<<flag) != 0
+}
+
+func SetFlag(registers Registers, flag RegisterFlag, value bool) {
+	registers[RI_flags] &^= 1 << flag
+	registers[RI_flags] |= BoolToInt(value) << flag
 }
 
 func BoolToInt(value bool) int16 {
@@ -166,16 +504,19 @@ func BoolToInt(value bool) int16 {
 }
 
 func (registers Registers) Print() {
-	printOrder := []RegisterIndex{RI_a, RI_b, RI_c, RI_d, RI_sp, RI_bp, RI_si, RI_di, RI_ip}
+	printOrder := []RegisterIndex{
+		RI_a, RI_b, RI_c, RI_d, RI_sp, RI_bp, RI_si, RI_di,
+		RI_es, RI_cs, RI_ss, RI_ds, RI_ip,
+	}
 
-	fmt.Println("; Registers")
+	fmt.Fprintln(Trace, "; Registers")
 	for _, idx := range printOrder {
 		v := registers[idx]
 		if v == 0 {
 			continue
 		}
 		reg := OperandRegister{idx, 0, 2}
-		fmt.Printf(";   %s: 0x%04x (%d)\n", reg, v, v)
+		fmt.Fprintf(Trace, ";   %s: 0x%04x (%d)\n", reg, uint16(v), v)
 	}
 
 	PrintFlags(registers[RI_flags])
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled expression over registers, flags and memory, like
+//
+//	ax == 0x10 && word [bp+si+4] > 3
+//
+// Operands are numbers (decimal, or hex with 0x), register names, flag names
+// (cf, pf, af, zf, sf, tf, if, df, of) which read 0 or 1, and memory reads
+// written byte [...] or word [...], with an optional segment such as
+// es:[di]. Like the CPU, addresses default to ds, or ss when they use bp.
+// Operators follow C and true is 1. Values are unsigned 16 bits and wrap like
+// the CPU's arithmetic, so -1 is 0xffff and compares above everything else;
+// dividing by zero gives zero.
+type Expr func(registers Registers, memory Memory) int64
+
+var flagNames = map[string]RegisterFlag{
+	"cf": RF_carry, "pf": RF_parity, "af": RF_aux, "zf": RF_zero, "sf": RF_sign,
+	"tf": RF_trap, "if": RF_interrupt, "df": RF_direction, "of": RF_overflow,
+}
+
+// binary operators from loosest to tightest binding
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func ParseExpr(text string) (Expr, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+
+	expr, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+
+	return expr, nil
+}
+
+func tokenize(text string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(text); {
+		c := rune(text[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(text) && (unicode.IsLetter(rune(text[i])) || unicode.IsDigit(rune(text[i]))) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+
+		default:
+			// two character operators first
+			if i+1 < len(text) {
+				switch pair := text[i : i+2]; pair {
+				case "||", "&&", "==", "!=", "<=", ">=", "<<", ">>":
+					tokens = append(tokens, pair)
+					i += 2
+					continue
+				}
+			}
+
+			if !strings.ContainsRune("|&^<>+-*/%!~()[]:", c) {
+				return nil, fmt.Errorf("unexpected %q in expression", c)
+			}
+
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+
+	usesBp bool // the memory address being parsed mentions bp
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+
+	return token
+}
+
+func (p *exprParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("expected %q in expression, got %q", token, got)
+	}
+
+	return nil
+}
+
+func (p *exprParser) binary(level int) (Expr, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		if !slices.Contains(precedence[level], op) {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryExpr(op, left, right)
+	}
+}
+
+func binaryExpr(op string, left, right Expr) Expr {
+	apply := map[string]func(l, r int64) int64{
+		"|":  func(l, r int64) int64 { return l | r },
+		"^":  func(l, r int64) int64 { return l ^ r },
+		"&":  func(l, r int64) int64 { return l & r },
+		"==": func(l, r int64) int64 { return boolValue(l == r) },
+		"!=": func(l, r int64) int64 { return boolValue(l != r) },
+		"<":  func(l, r int64) int64 { return boolValue(l < r) },
+		"<=": func(l, r int64) int64 { return boolValue(l <= r) },
+		">":  func(l, r int64) int64 { return boolValue(l > r) },
+		">=": func(l, r int64) int64 { return boolValue(l >= r) },
+		"<<": func(l, r int64) int64 { return l << (r & 63) },
+		">>": func(l, r int64) int64 { return l >> (r & 63) },
+		"+":  func(l, r int64) int64 { return l + r },
+		"-":  func(l, r int64) int64 { return l - r },
+		"*":  func(l, r int64) int64 { return l * r },
+		"/": func(l, r int64) int64 {
+			if r == 0 {
+				return 0
+			}
+			return l / r
+		},
+		"%": func(l, r int64) int64 {
+			if r == 0 {
+				return 0
+			}
+			return l % r
+		},
+	}[op]
+
+	switch op {
+	case "&&": // both short circuit
+		return func(registers Registers, memory Memory) int64 {
+			return boolValue(left(registers, memory) != 0 && right(registers, memory) != 0)
+		}
+	case "||":
+		return func(registers Registers, memory Memory) int64 {
+			return boolValue(left(registers, memory) != 0 || right(registers, memory) != 0)
+		}
+	}
+
+	return func(registers Registers, memory Memory) int64 {
+		return apply(left(registers, memory), right(registers, memory)) & 0xffff
+	}
+}
+
+func (p *exprParser) unary() (Expr, error) {
+	switch op := p.peek(); op {
+	case "-", "!", "~":
+		p.next()
+
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(registers Registers, memory Memory) int64 {
+			value := operand(registers, memory)
+			switch op {
+			case "-":
+				return -value & 0xffff
+			case "!":
+				return boolValue(value == 0)
+			}
+			return ^value & 0xffff
+		}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *exprParser) primary() (Expr, error) {
+	token := p.next()
+
+	switch {
+	case token == "(":
+		expr, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+
+		return expr, p.expect(")")
+
+	case token == "byte" || token == "word":
+		return p.memory(token == "word")
+
+	case token == "[":
+		p.pos--
+		return p.memory(true)
+
+	case token == "":
+		return nil, fmt.Errorf("expression ends too soon")
+	}
+
+	// a segment register followed by a colon starts a memory read
+	if p.peek() == ":" {
+		p.pos--
+		return p.memory(true)
+	}
+
+	if reg, ok := LookupRegister(token); ok {
+		if reg.Index == RI_bp {
+			p.usesBp = true
+		}
+
+		return func(registers Registers, memory Memory) int64 {
+			return int64(uint16(GetRegisterValue(reg, registers)))
+		}, nil
+	}
+
+	if flag, ok := flagNames[token]; ok {
+		return func(registers Registers, memory Memory) int64 {
+			return boolValue(GetFlag(registers, flag))
+		}, nil
+	}
+
+	// no octal, binary or underscores, whatever Go would take
+	digits, base := token, 10
+	if hex, ok := strings.CutPrefix(token, "0x"); ok {
+		digits, base = hex, 16
+	}
+
+	value, err := strconv.ParseUint(digits, base, 16)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, fmt.Errorf("%s doesn't fit in 16 bits", token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown %q in expression", token)
+	}
+
+	return func(registers Registers, memory Memory) int64 {
+		return int64(value)
+	}, nil
+}
+
+// memory parses [seg:][address] after byte or word.
+func (p *exprParser) memory(wide bool) (Expr, error) {
+	segment := RI_ds
+	overridden := p.peek() != "["
+	if overridden {
+		reg, ok := LookupRegister(p.next())
+		if !ok || reg.Index < RI_es || reg.Index > RI_ds {
+			return nil, fmt.Errorf("expected a segment register or [ in expression")
+		}
+
+		segment = reg.Index
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	outer := p.usesBp
+	p.usesBp = false
+
+	address, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !overridden && p.usesBp {
+		segment = RI_ss
+	}
+	p.usesBp = outer
+
+	return func(registers Registers, memory Memory) int64 {
+		offset := uint16(address(registers, memory))
+		return int64(memory.Load(uint16(registers[segment]), offset, wide))
+	}, p.expect("]")
+}
+
+func boolValue(value bool) int64 {
+	return int64(BoolToInt(value))
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestParseExpr(t *testing.T) {
+	memory := make(Memory, MemorySize)
+	registers := make(Registers, RI_Count)
+	registers[RI_a] = 0x10
+	registers[RI_b] = 0x0100
+	registers[RI_bp] = 0x0020
+	registers[RI_si] = 0x0002
+	registers[RI_ds] = 0x1000
+	registers[RI_ss] = 0x2000
+	registers[RI_es] = 0x3000
+	registers[RI_flags] = 1 << RF_zero
+
+	memory[PhysicalAddress(0x1000, 0x0100)] = 0x34
+	memory[PhysicalAddress(0x1000, 0x0101)] = 0x12
+	memory[PhysicalAddress(0x1000, 0x0022)] = 0x11 // ds:[bp+si], which bp doesn't read
+	memory[PhysicalAddress(0x2000, 0x0022)] = 0x22
+	memory[PhysicalAddress(0x2000, 0x0026)] = 0x05
+	memory[PhysicalAddress(0x1000, 0x0026)] = 0x06
+	memory[PhysicalAddress(0x3000, 0x0022)] = 0x33
+
+	tests := []struct {
+		text string
+		want int64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"1 << 2 + 1", 8},
+		{"6 & 3 == 3", 0},
+		{"1 | 2 ^ 3 & 1", 3},
+		{"ax == 0x10 && zf", 1},
+		{"ax == 0x10 && cf", 0},
+		{"cf || ax > 15", 1},
+		{"al + ah", 0x10},
+		{"!ax", 0},
+		{"~0", 0xffff},
+		{"-1", 0xffff},
+		{"-1 > ax", 1},
+		{"0 - 1 == -1", 1},
+		{"0xffff + 1", 0},
+		{"010", 10}, // decimal, not octal
+		{"0x010", 0x10},
+		{"7 / 0", 0},
+		{"7 % 0", 0},
+		{"word [bx]", 0x1234},
+		{"byte [bx+1]", 0x12},
+		{"[bx]", 0x1234},
+		{"byte [bp+si]", 0x22},
+		{"byte ds:[bp+si]", 0x11},
+		{"byte es:[bp+si]", 0x33},
+		{"byte [si+0x20]", 0x11},
+		{"word [bp+si+4] > 3", 1},
+		{"byte [bp+si+4]", 0x05},
+		{"byte [byte [bp+si] + 4]", 0x06}, // only the inner read uses bp
+	}
+
+	for _, test := range tests {
+		expr, err := ParseExpr(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+
+		if got := expr(registers, memory); got != test.want {
+			t.Errorf("%s is 0x%x, want 0x%x", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"1 +",
+		"(1",
+		"ax bx",
+		"foo",
+		"0x10000",
+		"0b101",
+		"0o17",
+		"1_000",
+		"0x",
+		"word [bx",
+		"byte ax:[bx]",
+		"ax = 1",
+	} {
+		if _, err := ParseExpr(text); err == nil {
+			t.Errorf("%q parsed", text)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Framebuffer is a region of memory read as a picture: one palette index a
+// pixel, like mode 13h at a000:0000; the interleaved scanlines of the CGA
+// graphics modes at b800:0000, four colours at 320x200 (mode 04h) or two at
+// 640x200 (mode 06h); or four bytes of red, green, blue and alpha a pixel,
+// like listing 54 draws.
+type Framebuffer struct {
+	Format          string // "mode13h", "cga4", "cga6" or "rgba"
+	Segment, Offset uint16
+	Width, Height   int
+}
+
+// ParseSize reads a "WIDTHxHEIGHT" size.
+func ParseSize(text string) (width, height int, err error) {
+	if _, err := fmt.Sscanf(text, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("size %q isn't WIDTHxHEIGHT", text)
+	}
+
+	return width, height, nil
+}
+
+// Render reads the framebuffer out of memory, wrapping at the top of memory
+// like the CPU would.
+func (fb Framebuffer) Render(memory Memory) image.Image {
+	picture := image.NewNRGBA(image.Rect(0, 0, fb.Width, fb.Height))
+	start := PhysicalAddress(fb.Segment, fb.Offset)
+
+	for y := range fb.Height {
+		for x := range fb.Width {
+			pixel := uint32(y*fb.Width + x)
+
+			index := memory[(start+pixel)%MemorySize]
+
+			switch fb.Format {
+			case "rgba":
+				at := func(i uint32) byte { return memory[(start+pixel*4+i)%MemorySize] }
+				picture.SetNRGBA(x, y, color.NRGBA{at(0), at(1), at(2), at(3)})
+				continue
+
+			case "cga4":
+				offset, shift := cgaPixel(x, y, fb.Width, 2)
+				index = Cga.Colors()[memory[(start+uint32(offset))%MemorySize]>>shift&3]
+
+			case "cga6":
+				offset, shift := cgaPixel(x, y, fb.Width, 1)
+				index = 0
+				if memory[(start+uint32(offset))%MemorySize]>>shift&1 != 0 {
+					index = Cga.Foreground()
+				}
+			}
+
+			r, g, b := Dac.Color(index)
+			picture.SetNRGBA(x, y, color.NRGBA{r, g, b, 0xff})
+		}
+	}
+
+	return picture
+}
+
+// WritePng renders the framebuffer to a PNG file.
+func (fb Framebuffer) WritePng(path string, memory Memory) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, fb.Render(memory))
+}
+
+// FramePath numbers a frame of an animation: out.png becomes out_000001.png.
+func FramePath(path string, frame int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%06d%s", strings.TrimSuffix(path, ext), frame, ext)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMode13hPng(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mode13h.png")
+	simulate(t, "-mode", "exec", "-format", "com", "-path", "listings/exec/sim8086_mode13h", "-png", path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	picture, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := picture.Bounds().Size(); size.X != 320 || size.Y != 200 {
+		t.Fatalf("picture is %v", size)
+	}
+
+	tests := []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{10, 20, color.NRGBA{0xaa, 0x00, 0x00, 0xff}}, // plotted, CGA red
+		{0, 100, color.NRGBA{0xff, 0x82, 0x00, 0xff}}, // stored, then the palette changed
+		{319, 100, color.NRGBA{0xff, 0x82, 0x00, 0xff}},
+		{0, 0, color.NRGBA{0x00, 0x00, 0x00, 0xff}},
+	}
+
+	for _, test := range tests {
+		if got := color.NRGBAModel.Convert(picture.At(test.x, test.y)); got != test.want {
+			t.Errorf("pixel %d,%d is %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		text          string
+		width, height int
+		ok            bool
+	}{
+		{"320x200", 320, 200, true},
+		{"640x200", 640, 200, true},
+		{"0x200", 0, 0, false},
+		{"320", 0, 0, false},
+		{"x", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		width, height, err := ParseSize(test.text)
+		if (err == nil) != test.ok || width != test.width || height != test.height {
+			t.Errorf("%q gives %dx%d, %v", test.text, width, height, err)
+		}
+	}
+}
+
+func TestFramePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		frame int
+		want  string
+	}{
+		{"out.png", 1, "out_000001.png"},
+		{"frames/run.png", 42, "frames/run_000042.png"},
+		{"noext", 3, "noext_000003"},
+	}
+
+	for _, test := range tests {
+		if got := FramePath(test.path, test.frame); got != test.want {
+			t.Errorf("frame %d of %s is %s, want %s", test.frame, test.path, got, test.want)
+		}
+	}
+}
+
+func TestCgaRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		width  int
+		stores map[uint16]byte // offsets into b800:0000
+		x, y   int
+		want   color.NRGBA
+	}{
+		{"first pixel of an even line", "cga4", 320, map[uint16]byte{0x0000: 0b11_000000}, 0, 0, color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"last pixel of a byte", "cga4", 320, map[uint16]byte{0x0000: 0b000000_01}, 3, 0, color.NRGBA{0x55, 0xff, 0xff, 0xff}},
+		{"odd lines are 8K up", "cga4", 320, map[uint16]byte{0x2000: 0b10_000000}, 0, 1, color.NRGBA{0xff, 0x55, 0xff, 0xff}},
+		{"line pairs are 80 bytes apart", "cga4", 320, map[uint16]byte{0x2050 + 1: 0b00_11_0000}, 5, 3, color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"background", "cga4", 320, map[uint16]byte{0x2000: 0b11_000000}, 0, 0, color.NRGBA{0, 0, 0, 0xff}},
+		{"eight pixels a byte at 640", "cga6", 640, map[uint16]byte{0x2000 + 80: 0b0000_0001}, 7, 3, color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"clear at 640", "cga6", 640, map[uint16]byte{0x0000: 0b0111_1111}, 0, 0, color.NRGBA{0, 0, 0, 0xff}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := make(Memory, MemorySize)
+			for offset, value := range test.stores {
+				memory[PhysicalAddress(TextSegment, offset)] = value
+			}
+
+			Cga.Value = 0x30
+			if test.format == "cga6" {
+				Cga.Value = 0x3f
+			}
+
+			fb := Framebuffer{Format: test.format, Segment: TextSegment, Width: test.width, Height: 200}
+			if got := fb.Render(memory).At(test.x, test.y); got != test.want {
+				t.Errorf("pixel %d,%d is %v, want %v", test.x, test.y, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCgaPalettes(t *testing.T) {
+	tests := []struct {
+		value byte
+		want  [4]byte
+	}{
+		{0x00, [4]byte{0, 2, 4, 6}},
+		{0x10, [4]byte{0, 10, 12, 14}},
+		{0x20, [4]byte{0, 3, 5, 7}},
+		{0x31, [4]byte{1, 11, 13, 15}},
+	}
+
+	for _, test := range tests {
+		cga := CgaColorSelect{test.value}
+		if got := cga.Colors(); got != test.want {
+			t.Errorf("colour select %02x gives %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCgaPlot(t *testing.T) {
+	memory := make(Memory, MemorySize)
+	registers := make(Registers, RI_Count)
+	setVideoMode(4, memory)
+
+	plot := func(ah, al byte, x, y int16) {
+		registers[RI_a] = int16(uint16(ah)<<8 | uint16(al))
+		registers[RI_c], registers[RI_d] = x, y
+		if err := biosVideo(registers, memory); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plot(0x0c, 2, 5, 3)
+	if got := memory[PhysicalAddress(TextSegment, 0x2051)]; got != 0b00_10_0000 {
+		t.Errorf("plotting 5,3 stored %08b", got)
+	}
+
+	// xor with bit 7, 2 ^ 3 is 1
+	plot(0x0c, 0x83, 5, 3)
+	plot(0x0d, 0, 5, 3)
+	if got := byte(registers[RI_a]); got != 1 {
+		t.Errorf("read back %d, want 1", got)
+	}
+}
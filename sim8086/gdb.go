@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// gdbRegisters is the order gdb's i386 target expects registers in, all 32
+// bits wide; fs and gs don't exist on the 8086 and read as zero.
+var gdbRegisters = []RegisterIndex{
+	RI_a, RI_c, RI_d, RI_b, RI_sp, RI_bp, RI_si, RI_di,
+	RI_ip, RI_flags, RI_cs, RI_ss, RI_ds, RI_es, RI_Count, RI_Count,
+}
+
+// GdbServer lets gdb drive the simulation over the remote serial protocol.
+// gdb doesn't know about segments, so like other real mode stubs addresses
+// in memory packets and breakpoints are physical, and a breakpoint stops
+// whenever cs:ip comes to it. Attach with
+//
+//	(gdb) set architecture i8086
+//	(gdb) target remote localhost:1234
+type GdbServer struct {
+	step      func() bool
+	exitCode  func() int
+	registers Registers
+	memory    Memory
+
+	conn       net.Conn
+	packets    chan string   // from the reader, closed when gdb goes away
+	interrupts chan struct{} // gdb pressed ctrl-c
+	acking     atomic.Bool   // gdb hasn't asked for no-ack mode
+	last       string        // packet to send again if gdb asks
+
+	breakpoints map[uint32]bool
+	watchpoints map[uint32]bool // physical addresses written to stop after
+	running     bool            // a step is in progress, so stores are the program's
+	watched     []uint32        // watched addresses the last step wrote
+	finished    bool
+	detached    bool
+}
+
+func NewGdbServer(step func() bool, exitCode func() int, registers Registers,
+	memory Memory) *GdbServer {
+	g := &GdbServer{
+		step:        step,
+		exitCode:    exitCode,
+		registers:   registers,
+		memory:      memory,
+		breakpoints: map[uint32]bool{},
+		watchpoints: map[uint32]bool{},
+	}
+	StoreHooks = append(StoreHooks, g.watch)
+
+	return g
+}
+
+// Serve waits for gdb on address and answers it until it kills the program,
+// detaches or goes away.
+func (g *GdbServer) Serve(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "; waiting for gdb on %s\n", listener.Addr())
+
+	g.conn, err = listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer g.conn.Close()
+
+	g.acking.Store(true)
+	g.packets = make(chan string)
+	g.interrupts = make(chan struct{}, 1)
+	go g.read()
+
+	for packet := range g.packets {
+		if packet == "-" {
+			g.send(g.last)
+			continue
+		}
+
+		// kill wants no reply, just the program gone
+		if packet == "k" {
+			break
+		}
+
+		reply, done := g.handle(packet)
+		g.send(reply)
+
+		if done {
+			break
+		}
+	}
+
+	// once detached the program finishes on its own
+	for g.detached && !g.finished {
+		g.finished = g.step()
+	}
+
+	return nil
+}
+
+// read splits what gdb sends into packets, acknowledging each one, and
+// passes ctrl-c on separately so a running program can notice it.
+func (g *GdbServer) read() {
+	defer close(g.packets)
+	reader := bufio.NewReader(g.conn)
+
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch c {
+		case 0x03:
+			select {
+			case g.interrupts <- struct{}{}:
+			default:
+			}
+
+		case '-':
+			g.packets <- "-"
+
+		case '$':
+			data, err := reader.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = strings.TrimSuffix(data, "#")
+
+			checksum := make([]byte, 2)
+			if _, err := io.ReadFull(reader, checksum); err != nil {
+				return
+			}
+
+			if g.acking.Load() {
+				sum, err := strconv.ParseUint(string(checksum), 16, 8)
+				if err != nil || byte(sum) != gdbChecksum(data) {
+					g.conn.Write([]byte("-"))
+					continue
+				}
+
+				g.conn.Write([]byte("+"))
+			}
+
+			g.packets <- data
+		}
+	}
+}
+
+func (g *GdbServer) send(data string) {
+	g.last = data
+	fmt.Fprintf(g.conn, "$%s#%02x", data, gdbChecksum(data))
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := range len(data) {
+		sum += data[i]
+	}
+
+	return sum
+}
+
+// handle answers one packet, and says whether the session is over. Packets
+// it doesn't know get an empty reply, which tells gdb they're unsupported.
+func (g *GdbServer) handle(packet string) (reply string, done bool) {
+	if packet == "" {
+		return "", false
+	}
+
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return g.stopReply(), false
+
+	case 'g':
+		var out strings.Builder
+		for _, idx := range gdbRegisters {
+			out.WriteString(g.register(idx))
+		}
+		return out.String(), false
+
+	case 'G':
+		for i, idx := range gdbRegisters {
+			if len(args) < (i+1)*8 {
+				break
+			}
+			g.setRegister(idx, args[i*8:(i+1)*8])
+		}
+		return "OK", false
+
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || int(n) >= len(gdbRegisters) {
+			return "E01", false
+		}
+		return g.register(gdbRegisters[n]), false
+
+	case 'P':
+		number, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(number, 16, 8)
+		if err != nil || int(n) >= len(gdbRegisters) {
+			return "E01", false
+		}
+		g.setRegister(gdbRegisters[n], value)
+		return "OK", false
+
+	case 'm':
+		address, length, err := gdbRange(args)
+		if err != nil {
+			return "E01", false
+		}
+
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = g.memory[(address+uint32(i))%MemorySize]
+		}
+		return hex.EncodeToString(data), false
+
+	case 'M':
+		where, text, _ := strings.Cut(args, ":")
+		address, length, err := gdbRange(where)
+		data, hexErr := hex.DecodeString(text)
+		if err != nil || hexErr != nil || len(data) != int(length) {
+			return "E01", false
+		}
+
+		// through Store, so the screen and hooks see it like any write
+		for i, b := range data {
+			at := (address + uint32(i)) % MemorySize
+			g.memory.Store(uint16(at>>4), uint16(at&0xf), uint16(b), false)
+		}
+		return "OK", false
+
+	case 'c', 's':
+		// gdb may say where to resume
+		if args != "" {
+			address, err := strconv.ParseUint(args, 16, 32)
+			if err != nil {
+				return "E01", false
+			}
+			g.registers[RI_ip] = int16(uint32(address) - uint32(uint16(g.registers[RI_cs]))<<4)
+		}
+
+		return g.resume(packet[0] == 's'), false
+
+	case 'Z', 'z':
+		kind, rest, _ := strings.Cut(args, ",")
+		address, length, err := gdbRange(rest)
+		if err != nil {
+			return "E01", false
+		}
+
+		insert := packet[0] == 'Z'
+		switch kind {
+		case "0", "1":
+			g.breakpoints[address] = insert
+		case "2":
+			for i := range length {
+				g.watchpoints[(address+i)%MemorySize] = insert
+			}
+		default:
+			return "", false
+		}
+		return "OK", false
+
+	case 'H', 'T':
+		// one thread, always alive
+		return "OK", false
+
+	case 'q':
+		switch {
+		case strings.HasPrefix(args, "Supported"):
+			return "PacketSize=4000;QStartNoAckMode+", false
+		case args == "Attached":
+			return "1", false
+		case args == "C":
+			return "QC1", false
+		case args == "fThreadInfo":
+			return "m1", false
+		case args == "sThreadInfo":
+			return "l", false
+		}
+
+	case 'Q':
+		if args == "StartNoAckMode" {
+			g.acking.Store(false)
+			return "OK", false
+		}
+
+	case 'D':
+		g.detached = true
+		return "OK", true
+	}
+
+	return "", false
+}
+
+// resume steps once, or until a breakpoint, a watched write, ctrl-c or the
+// end of the program.
+func (g *GdbServer) resume(single bool) string {
+	select {
+	case <-g.interrupts:
+	default:
+	}
+
+	for !g.finished {
+		g.watched = nil
+
+		g.running = true
+		g.finished = g.step()
+		g.running = false
+
+		if g.finished {
+			break
+		}
+
+		if len(g.watched) > 0 {
+			return fmt.Sprintf("T05watch:%x;", g.watched[0])
+		}
+
+		ip := PhysicalAddress(uint16(g.registers[RI_cs]), uint16(g.registers[RI_ip]))
+		if single || g.breakpoints[ip] {
+			break
+		}
+
+		select {
+		case <-g.interrupts:
+			return "S02"
+		default:
+		}
+	}
+
+	return g.stopReply()
+}
+
+func (g *GdbServer) stopReply() string {
+	if g.finished {
+		return fmt.Sprintf("W%02x", byte(g.exitCode()))
+	}
+
+	return "S05"
+}
+
+// watch is the store hook that notices writes gdb set a watchpoint on.
+func (g *GdbServer) watch(address uint32, old, value byte) {
+	if g.running && g.watchpoints[address] {
+		g.watched = append(g.watched, address)
+	}
+}
+
+// register reads as 8 hex digits, 32 bits little endian.
+func (g *GdbServer) register(idx RegisterIndex) string {
+	value := uint16(0)
+	if idx != RI_Count {
+		value = uint16(g.registers[idx])
+	}
+
+	return fmt.Sprintf("%02x%02x0000", byte(value), byte(value>>8))
+}
+
+// setRegister takes the low 16 bits of a little endian hex value.
+func (g *GdbServer) setRegister(idx RegisterIndex, text string) {
+	data, err := hex.DecodeString(text)
+	if err != nil || len(data) < 2 || idx == RI_Count {
+		return
+	}
+
+	g.registers[idx] = int16(uint16(data[0]) | uint16(data[1])<<8)
+}
+
+// gdbRange reads "ADDR,LENGTH" in hex.
+func gdbRange(text string) (address, length uint32, err error) {
+	addressText, lengthText, _ := strings.Cut(text, ",")
+
+	a, err := strconv.ParseUint(addressText, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	l, err := strconv.ParseUint(lengthText, 16, 32)
+	if err != nil || l > 0x10000 {
+		return 0, 0, fmt.Errorf("bad length %q", lengthText)
+	}
+
+	return uint32(a) % MemorySize, uint32(l), nil
+}
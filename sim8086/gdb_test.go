@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGdbChecksum(t *testing.T) {
+	tests := []struct {
+		data string
+		want byte
+	}{
+		{"", 0x00},
+		{"OK", 0x9a},
+		{"g", 0x67},
+		{"S05", 0xb8},
+		{"qSupported:multiprocess+", 0xc6}, // wraps past 0xff
+	}
+
+	for _, test := range tests {
+		if got := gdbChecksum(test.data); got != test.want {
+			t.Errorf("checksum of %q is %02x, want %02x", test.data, got, test.want)
+		}
+	}
+}
+
+func TestGdbRange(t *testing.T) {
+	tests := []struct {
+		text            string
+		address, length uint32
+		ok              bool
+	}{
+		{"7c00,10", 0x7c00, 0x10, true},
+		{"0,0", 0, 0, true},
+		{"100000,2", 0, 2, true}, // wraps at 1MB like the address bus
+		{"ffff0,10000", 0xffff0, 0x10000, true},
+		{"0,10001", 0, 0, false},
+		{"zz,2", 0, 0, false},
+		{"7c00", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		address, length, err := gdbRange(test.text)
+		if (err == nil) != test.ok || address != test.address || length != test.length {
+			t.Errorf("%q gives %x,%x, %v", test.text, address, length, err)
+		}
+	}
+}
+
+// gdbTarget is a server over a pretend program: each step stores ip's low
+// byte at 0500+ip and moves ip on by one, and the program ends after five.
+func gdbTarget() *GdbServer {
+	memory := make(Memory, MemorySize)
+	registers := make(Registers, RI_Count)
+	registers[RI_cs] = 0x0100
+
+	steps := 0
+	step := func() bool {
+		ip := uint16(registers[RI_ip])
+		memory.Store(0, 0x500+ip, ip&0xff, false)
+		registers[RI_ip]++
+		steps++
+
+		return steps == 5
+	}
+
+	return NewGdbServer(step, func() int { return 3 }, registers, memory)
+}
+
+func TestGdbHandle(t *testing.T) {
+	g := gdbTarget()
+	g.registers[RI_a] = 0x1234
+	copy(g.memory[0x1000:], "hello")
+
+	tests := []struct {
+		packet, want string
+	}{
+		{"?", "S05"},
+		{"p0", "34120000"},
+		{"p8", "00000000"},
+		{"pa", "00010000"},
+		{"pe", "00000000"}, // fs reads as zero
+		{"p10", "E01"},
+		{"P3=cdab0000", "OK"},
+		{"p3", "cdab0000"},
+		{"m1000,5", "68656c6c6f"},
+		{"M1001,2:4142", "OK"},
+		{"m1000,5", "6841426c6f"},
+		{"M1000,2:41", "E01"},
+		{"m1000", "E01"},
+		{"qSupported:xmlRegisters=i386", "PacketSize=4000;QStartNoAckMode+"},
+		{"qAttached", "1"},
+		{"qfThreadInfo", "m1"},
+		{"qsThreadInfo", "l"},
+		{"Hg0", "OK"},
+		{"vMustReplyEmpty", ""},
+		{"Z3,1000,1", ""},
+	}
+
+	for _, test := range tests {
+		if got, done := g.handle(test.packet); got != test.want || done {
+			t.Errorf("%q gets %q, %v, want %q", test.packet, got, done, test.want)
+		}
+	}
+
+	registers := []string{
+		"34120000", "00000000", "00000000", "cdab0000", "00000000", "00000000", "00000000", "00000000",
+		"00000000", "00000000", "00010000", "00000000", "00000000", "00000000", "00000000", "00000000",
+	}
+	if got, _ := g.handle("g"); got != strings.Join(registers, "") {
+		t.Errorf("g gets %s", got)
+	}
+}
+
+func TestGdbResume(t *testing.T) {
+	g := gdbTarget()
+
+	// 0100:0002 is 1002 physical
+	tests := []struct {
+		packet, want string
+	}{
+		{"s", "S05"},
+		{"Z0,1003,1", "OK"},
+		{"c", "S05"},
+		{"p8", "03000000"},
+		{"z0,1003,1", "OK"},
+		{"Z2,503,2", "OK"},
+		{"c", "T05watch:503;"},
+		{"p8", "04000000"},
+		{"c", "W03"},
+		{"?", "W03"},
+		{"s", "W03"},
+	}
+
+	for _, test := range tests {
+		if got, _ := g.handle(test.packet); got != test.want {
+			t.Errorf("%q gets %q, want %q", test.packet, got, test.want)
+		}
+	}
+}
+
+func TestGdbDetach(t *testing.T) {
+	g := gdbTarget()
+
+	if reply, done := g.handle("D"); reply != "OK" || !done || !g.detached {
+		t.Errorf("detach gets %q, %v", reply, done)
+	}
+}
+
+// TestGdbSession talks to the simulator the way gdb would, over TCP with
+// checksums and acknowledgements.
+func TestGdbSession(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	cmd := exec.Command(os.Args[0], "-mode", "gdb", "-gdb", address, "-path", "listings/exec/listing_0043_immediate_movs")
+	cmd.Env = append(os.Environ(), "SIM8086_MAIN=1")
+	cmd.Stdout = io.Discard
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+
+	var conn net.Conn
+	for range 100 {
+		if conn, err = net.Dial("tcp", address); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reader := bufio.NewReader(conn)
+
+	exchange := func(packet, want string) {
+		t.Helper()
+
+		fmt.Fprintf(conn, "$%s#%02x", packet, gdbChecksum(packet))
+
+		reply, err := reader.ReadString('#')
+		if err != nil {
+			t.Fatal(err)
+		}
+		checksum := make([]byte, 2)
+		if _, err := io.ReadFull(reader, checksum); err != nil {
+			t.Fatal(err)
+		}
+
+		data := strings.TrimPrefix(reply[:len(reply)-1], "+$")
+		if data != want {
+			t.Errorf("%q gets %q, want %q", packet, reply, want)
+		}
+		if string(checksum) != fmt.Sprintf("%02x", gdbChecksum(data)) {
+			t.Errorf("%q gets checksum %s for %q", packet, checksum, data)
+		}
+	}
+
+	exchange("?", "S05")
+	exchange("p8", "00000000")
+	exchange("s", "S05")
+	exchange("p8", "03000000")
+	exchange("p0", "01000000")
+	exchange("c", "W00")
+
+	// a bad checksum is refused and gdb sends again
+	conn.Write([]byte("$?#00"))
+	if ack, _ := reader.ReadByte(); ack != '-' {
+		t.Errorf("bad checksum acknowledged with %q", ack)
+	}
+
+	fmt.Fprintf(conn, "$k#%02x", gdbChecksum("k"))
+	if ack, _ := reader.ReadByte(); ack != '+' {
+		t.Errorf("kill acknowledged with %q", ack)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+// RegisterChange is one register, flags included, before and after an
+// instruction.
+type RegisterChange struct {
+	Index    RegisterIndex
+	Old, New int16
+}
+
+// MemoryChange is one byte an instruction stored, in the order it did.
+type MemoryChange struct {
+	Address uint32 `json:"address"`
+	Old     byte   `json:"old"`
+	Value   byte   `json:"value"`
+}
+
+// Delta is everything one step changed in the CPU and memory, enough to
+// undo it. Devices aren't recorded: a rewound program doesn't take back
+// characters it printed or timer ticks that passed.
+type Delta struct {
+	Registers []RegisterChange
+	Memory    []MemoryChange
+}
+
+// historyLimit bounds how far back a History goes, in steps.
+const historyLimit = 1 << 20
+
+// History records a Delta for each step so execution can be run backwards.
+// Watch memory with Store as a store hook, and bracket each step with Begin
+// and End.
+type History struct {
+	deltas []Delta
+
+	recording bool
+	before    [RI_Count]int16
+	current   Delta
+}
+
+func (h *History) Begin(registers Registers) {
+	copy(h.before[:], registers)
+	h.current = Delta{}
+	h.recording = true
+}
+
+func (h *History) Store(address uint32, old, value byte) {
+	if h.recording {
+		h.current.Memory = append(h.current.Memory, MemoryChange{address, old, value})
+	}
+}
+
+// End records what changed since Begin as a step of its own, even when
+// nothing did like a jmp $, so steps are undone one at a time. A step that
+// finished the program without changing anything ran nothing and is left out.
+func (h *History) End(registers Registers, finished bool) {
+	h.recording = false
+
+	for idx, old := range h.before {
+		if registers[idx] != old {
+			h.current.Registers = append(h.current.Registers, RegisterChange{RegisterIndex(idx), old, registers[idx]})
+		}
+	}
+
+	if finished && len(h.current.Registers) == 0 && len(h.current.Memory) == 0 {
+		return
+	}
+
+	if len(h.deltas) == historyLimit {
+		h.deltas = h.deltas[1:]
+	}
+	h.deltas = append(h.deltas, h.current)
+}
+
+// Len is how many steps can be undone.
+func (h *History) Len() int {
+	return len(h.deltas)
+}
+
+// Undo takes back the last step, restoring memory through the store hooks
+// so watchers see it, and returns what it undid.
+func (h *History) Undo(registers Registers, memory Memory) (Delta, bool) {
+	if len(h.deltas) == 0 {
+		return Delta{}, false
+	}
+
+	delta := h.deltas[len(h.deltas)-1]
+	h.deltas = h.deltas[:len(h.deltas)-1]
+
+	for i := len(delta.Memory) - 1; i >= 0; i-- {
+		memory.storeByte(delta.Memory[i].Address, delta.Memory[i].Old)
+	}
+
+	for _, change := range delta.Registers {
+		registers[change.Index] = change.Old
+	}
+
+	return delta, true
+}
@@ -18,6 +18,12 @@ const (
 	Bits_D
 	Bits_S
 	Bits_E // made up flag, opposite to D
+	Bits_V
+
+	Bits_SR
+	Bits_Port
+	Bits_RmAlwaysW // rm register is wide regardless of W, e.g. dx in `in al, dx`
+	Bits_Far       // intersegment transfer, ADDR is followed by a segment
 
 	Bits_HasData
 	Bits_HasDisp
@@ -46,10 +52,13 @@ var D_FLAG = Bits{Bits_D, 1, 0}
 var W_FLAG = Bits{Bits_W, 1, 0}
 var S_FLAG = Bits{Bits_S, 1, 0}
 var E_FLAG = Bits{Bits_E, 1, 0}
+var V_FLAG = Bits{Bits_V, 1, 0}
 
 var MOD = Bits{Bits_Mod, 2, 0}
 var REG = Bits{Bits_Reg, 3, 0}
 var RM = Bits{Bits_Rm, 3, 0}
+var SR = Bits{Bits_SR, 2, 0}
+var PORT = Bits{Bits_Port, 8, 0}
 
 var DATA = Bits{Bits_HasData, 0, 0}
 var ADDR = Bits{Bits_HasAddr, 0, 0}
@@ -65,19 +74,132 @@ var Blueprints = []IstructionBlueprint{
 	{"mov", []Bits{Const(7, 0b1100011), W_FLAG, MOD, Const(3, 0), RM, DISP, DATA}},
 	{"mov", []Bits{Const(4, 0b1011), W_FLAG, REG, DATA, Implicit(Bits_D, 1)}},
 	{"mov", []Bits{Const(6, 0b101000), E_FLAG, W_FLAG, ADDR, Implicit(Bits_Reg, 0)}},
+	{"mov", []Bits{Const(8, 0b10001110), MOD, Const(1, 0), SR, RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"mov", []Bits{Const(8, 0b10001100), MOD, Const(1, 0), SR, RM, DISP, Implicit(Bits_W, 1)}},
+
+	{"push", []Bits{Const(8, 0b11111111), MOD, Const(3, 0b110), RM, DISP, Implicit(Bits_W, 1)}},
+	{"push", []Bits{Const(5, 0b01010), REG, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"push", []Bits{Const(3, 0b000), SR, Const(3, 0b110), Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+
+	{"pop", []Bits{Const(8, 0b10001111), MOD, Const(3, 0b000), RM, DISP, Implicit(Bits_W, 1)}},
+	{"pop", []Bits{Const(5, 0b01011), REG, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"pop", []Bits{Const(3, 0b000), SR, Const(3, 0b111), Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+
+	{"xchg", []Bits{Const(7, 0b1000011), W_FLAG, MOD, REG, RM, DISP, Implicit(Bits_D, 1)}},
+	{"nop", []Bits{Const(8, 0b10010000)}}, // xchg ax, ax
+	{"xchg", []Bits{Const(5, 0b10010), REG, Implicit(Bits_W, 1), Implicit(Bits_Mod, 0b11), Implicit(Bits_Rm, 0)}},
+
+	{"in", []Bits{Const(7, 0b1110010), W_FLAG, PORT, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+	{"in", []Bits{Const(7, 0b1110110), W_FLAG, Implicit(Bits_Reg, 0), Implicit(Bits_Mod, 0b11), Implicit(Bits_Rm, 0b010), Implicit(Bits_RmAlwaysW, 1), Implicit(Bits_D, 1)}},
+	{"out", []Bits{Const(7, 0b1110011), W_FLAG, PORT, Implicit(Bits_Reg, 0)}},
+	{"out", []Bits{Const(7, 0b1110111), W_FLAG, Implicit(Bits_Reg, 0), Implicit(Bits_Mod, 0b11), Implicit(Bits_Rm, 0b010), Implicit(Bits_RmAlwaysW, 1)}},
+
+	{"xlat", []Bits{Const(8, 0b11010111)}},
+	{"lea", []Bits{Const(8, 0b10001101), MOD, REG, RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"lds", []Bits{Const(8, 0b11000101), MOD, REG, RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"les", []Bits{Const(8, 0b11000100), MOD, REG, RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+	{"lahf", []Bits{Const(8, 0b10011111)}},
+	{"sahf", []Bits{Const(8, 0b10011110)}},
+	{"pushf", []Bits{Const(8, 0b10011100)}},
+	{"popf", []Bits{Const(8, 0b10011101)}},
 
 	{"add", []Bits{Const(6, 0b000000), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
 	{"add", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0), RM, DISP, DATA}},
 	{"add", []Bits{Const(7, 0b0000010), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
 
+	{"adc", []Bits{Const(6, 0b000100), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
+	{"adc", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b010), RM, DISP, DATA}},
+	{"adc", []Bits{Const(7, 0b0001010), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"inc", []Bits{Const(7, 0b1111111), W_FLAG, MOD, Const(3, 0b000), RM, DISP}},
+	{"inc", []Bits{Const(5, 0b01000), REG, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+
 	{"sub", []Bits{Const(6, 0b001010), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
 	{"sub", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b101), RM, DISP, DATA}},
 	{"sub", []Bits{Const(7, 0b0010110), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
 
+	{"sbb", []Bits{Const(6, 0b000110), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
+	{"sbb", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b011), RM, DISP, DATA}},
+	{"sbb", []Bits{Const(7, 0b0001110), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"dec", []Bits{Const(7, 0b1111111), W_FLAG, MOD, Const(3, 0b001), RM, DISP}},
+	{"dec", []Bits{Const(5, 0b01001), REG, Implicit(Bits_W, 1), Implicit(Bits_D, 1)}},
+
+	{"neg", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b011), RM, DISP}},
+
 	{"cmp", []Bits{Const(6, 0b001110), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
 	{"cmp", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b111), RM, DISP, DATA}},
 	{"cmp", []Bits{Const(7, 0b0011110), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
 
+	{"mul", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b100), RM, DISP}},
+	{"imul", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b101), RM, DISP}},
+	{"div", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b110), RM, DISP}},
+	{"idiv", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b111), RM, DISP}},
+	{"cbw", []Bits{Const(8, 0b10011000)}},
+	{"cwd", []Bits{Const(8, 0b10011001)}},
+
+	{"and", []Bits{Const(6, 0b001000), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
+	{"and", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b100), RM, DISP, DATA}},
+	{"and", []Bits{Const(7, 0b0010010), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"or", []Bits{Const(6, 0b000010), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
+	{"or", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b001), RM, DISP, DATA}},
+	{"or", []Bits{Const(7, 0b0000110), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"xor", []Bits{Const(6, 0b001100), D_FLAG, W_FLAG, MOD, REG, RM, DISP}},
+	{"xor", []Bits{Const(6, 0b100000), S_FLAG, W_FLAG, MOD, Const(3, 0b110), RM, DISP, DATA}},
+	{"xor", []Bits{Const(7, 0b0011010), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"test", []Bits{Const(7, 0b1000010), W_FLAG, MOD, REG, RM, DISP}},
+	{"test", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b000), RM, DISP, DATA}},
+	{"test", []Bits{Const(7, 0b1010100), W_FLAG, DATA, Implicit(Bits_Reg, 0), Implicit(Bits_D, 1)}},
+
+	{"not", []Bits{Const(7, 0b1111011), W_FLAG, MOD, Const(3, 0b010), RM, DISP}},
+
+	{"rol", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b000), RM, DISP}},
+	{"ror", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b001), RM, DISP}},
+	{"rcl", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b010), RM, DISP}},
+	{"rcr", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b011), RM, DISP}},
+	{"shl", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b100), RM, DISP}},
+	{"shr", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b101), RM, DISP}},
+	{"sar", []Bits{Const(6, 0b110100), V_FLAG, W_FLAG, MOD, Const(3, 0b111), RM, DISP}},
+
+	{"movs", []Bits{Const(7, 0b1010010), W_FLAG}},
+	{"cmps", []Bits{Const(7, 0b1010011), W_FLAG}},
+	{"scas", []Bits{Const(7, 0b1010111), W_FLAG}},
+	{"lods", []Bits{Const(7, 0b1010110), W_FLAG}},
+	{"stos", []Bits{Const(7, 0b1010101), W_FLAG}},
+
+	{"clc", []Bits{Const(8, 0b11111000)}},
+	{"cmc", []Bits{Const(8, 0b11110101)}},
+	{"stc", []Bits{Const(8, 0b11111001)}},
+	{"cld", []Bits{Const(8, 0b11111100)}},
+	{"std", []Bits{Const(8, 0b11111101)}},
+	{"cli", []Bits{Const(8, 0b11111010)}},
+	{"sti", []Bits{Const(8, 0b11111011)}},
+	{"hlt", []Bits{Const(8, 0b11110100)}},
+
+	{"call", []Bits{Const(8, 0b11101000), DATA, Implicit(Bits_W, 1)}},
+	{"call", []Bits{Const(8, 0b11111111), MOD, Const(3, 0b010), RM, DISP, Implicit(Bits_W, 1)}},
+	{"call", []Bits{Const(8, 0b10011010), ADDR, Implicit(Bits_Far, 1)}},
+	{"call", []Bits{Const(8, 0b11111111), MOD, Const(3, 0b011), RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_Far, 1)}},
+
+	{"jmp", []Bits{Const(8, 0b11101001), DATA, Implicit(Bits_W, 1)}},
+	{"jmp", []Bits{Const(8, 0b11101011), DATA}},
+	{"jmp", []Bits{Const(8, 0b11111111), MOD, Const(3, 0b100), RM, DISP, Implicit(Bits_W, 1)}},
+	{"jmp", []Bits{Const(8, 0b11101010), ADDR, Implicit(Bits_Far, 1)}},
+	{"jmp", []Bits{Const(8, 0b11111111), MOD, Const(3, 0b101), RM, DISP, Implicit(Bits_W, 1), Implicit(Bits_Far, 1)}},
+
+	{"ret", []Bits{Const(8, 0b11000011)}},
+	{"ret", []Bits{Const(8, 0b11000010), DATA, Implicit(Bits_W, 1)}},
+	{"retf", []Bits{Const(8, 0b11001011)}},
+	{"retf", []Bits{Const(8, 0b11001010), DATA, Implicit(Bits_W, 1)}},
+
+	{"int", []Bits{Const(8, 0b11001101), DATA}},
+	{"int3", []Bits{Const(8, 0b11001100)}},
+	{"into", []Bits{Const(8, 0b11001110)}},
+	{"iret", []Bits{Const(8, 0b11001111)}},
+
 	{"jo", []Bits{Const(4, 0b0111), Const(4, 0), DATA}},
 	{"jno", []Bits{Const(4, 0b0111), Const(4, 1), DATA}},
 	{"jb", []Bits{Const(4, 0b0111), Const(4, 2), DATA}},
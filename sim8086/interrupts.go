@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BiosSegment holds an iret for every interrupt vector. Environments with a
+// BIOS or DOS point the vector table there, and reaching one of these stubs
+// runs the matching built-in handler before the iret returns.
+const BiosSegment = 0xf000
+
+type InterruptHandler func(registers Registers, memory Memory) error
+
+var InterruptHandlers = map[byte]InterruptHandler{}
+
+// ProgramExit ends the simulation when the program terminates itself.
+type ProgramExit struct {
+	Code byte
+}
+
+func (exit ProgramExit) Error() string {
+	return fmt.Sprintf("program exited with code %d", exit.Code)
+}
+
+// ErrHalt is returned for hlt, the CPU then idles until an interrupt.
+var ErrHalt = errors.New("halted")
+
+// Responding to an interrupt request costs about as much as an int.
+const interruptCycles = 61
+
+func InstallInterruptVectors(memory Memory) {
+	segment := uint16(BiosSegment)
+
+	for vector := range uint16(256) {
+		memory.Store(segment, vector, 0xcf, false) // iret
+		memory.Store(0, vector*4, vector, true)
+		memory.Store(0, vector*4+2, segment, true)
+	}
+}
+
+// RunInterruptHandler calls the built-in handler when cs:ip sits on its
+// stub, whether the program raised the interrupt or chained to the default.
+func RunInterruptHandler(registers Registers, memory Memory) error {
+	if uint16(registers[RI_cs]) != BiosSegment || uint16(registers[RI_ip]) > 0xff {
+		return nil
+	}
+
+	handler, ok := InterruptHandlers[byte(registers[RI_ip])]
+	if !ok {
+		return nil
+	}
+
+	return handler(registers, memory)
+}
+
+// Interrupt pushes flags, cs and ip and continues at the handler found in the
+// interrupt vector table at the bottom of memory.
+func Interrupt(vector byte, registers Registers, memory Memory) error {
+	offset := memory.Load(0, uint16(vector)*4, true)
+	segment := memory.Load(0, uint16(vector)*4+2, true)
+
+	if offset == 0 && segment == 0 {
+		return fmt.Errorf("unhandled interrupt %d", vector)
+	}
+
+	Push(FlagsImage(registers), registers, memory)
+	Push(registers[RI_cs], registers, memory)
+	Push(registers[RI_ip], registers, memory)
+
+	SetFlag(registers, RF_interrupt, false)
+	SetFlag(registers, RF_trap, false)
+
+	registers[RI_cs] = int16(segment)
+	registers[RI_ip] = int16(offset)
+
+	return nil
+}
+
+// HardwareInterrupt takes the most urgent request from the interrupt
+// controller when IF allows it. It reports whether one was taken.
+func HardwareInterrupt(registers Registers, memory Memory) (bool, error) {
+	if !GetFlag(registers, RF_interrupt) {
+		return false, nil
+	}
+
+	line, ok := Pic.Pending()
+	if !ok {
+		return false, nil
+	}
+
+	vector := Pic.Acknowledge(line)
+	TraceInterruptRequest(line, vector)
+
+	return true, Interrupt(vector, registers, memory)
+}
+
+// WaitForInterrupt lets the clock run after hlt until a request the CPU will
+// take comes in, and returns the cycles that went by. It gives up when
+// interrupts are disabled or the timer's longest period passes without one.
+func WaitForInterrupt(registers Registers) (cycles int, ok bool) {
+	if !GetFlag(registers, RF_interrupt) {
+		return 0, false
+	}
+
+	for cycles <= 0x10000*cyclesPerPitTick {
+		if _, ok := Pic.Pending(); ok {
+			return cycles, true
+		}
+
+		Ports.Tick(cyclesPerPitTick)
+		cycles += cyclesPerPitTick
+	}
+
+	return cycles, false
+}
+
+// InterruptShadow tells whether an instruction holds off interrupts until
+// the one after it: sti, so sti; hlt and sti; ret work, and loads of ss, so
+// the sp load that follows completes the new stack first.
+func InterruptShadow(inst *Instruction) bool {
+	switch inst.Op {
+	case "sti":
+		return true
+	case "mov", "pop":
+		reg, ok := inst.Operands[0].(OperandRegister)
+		return ok && reg.Index == RI_ss
+	}
+
+	return false
+}
+
+func Push(value int16, registers Registers, memory Memory) {
+	registers[RI_sp] -= 2
+	memory.Store(uint16(registers[RI_ss]), uint16(registers[RI_sp]), uint16(value), true)
+}
+
+func Pop(registers Registers, memory Memory) int16 {
+	value := memory.Load(uint16(registers[RI_ss]), uint16(registers[RI_sp]), true)
+	registers[RI_sp] += 2
+
+	return int16(value)
+}
+
+// SetReturnFlag changes a flag in the image an interrupt pushed, so the iret
+// that ends a built-in handler hands it back to the caller. DOS and the BIOS
+// report errors in carry this way.
+func SetReturnFlag(flag RegisterFlag, value bool, registers Registers, memory Memory) {
+	ss := uint16(registers[RI_ss])
+	sp := uint16(registers[RI_sp]) + 4
+
+	flags := memory.Load(ss, sp, true) &^ (1 << flag)
+	if value {
+		flags |= 1 << flag
+	}
+
+	memory.Store(ss, sp, flags, true)
+}
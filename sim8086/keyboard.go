@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// Keyboard is where programs get keys from. On a live terminal a reader
+// keeps a type-ahead buffer filled as keys arrive, like the keyboard
+// interrupt does for the BIOS, so a program can poll without the simulator
+// waiting on the terminal. Scripted input is read directly, since it never
+// has to be waited for and runs the same every time.
+type Keyboard struct {
+	input *bufio.Reader
+	keys  chan byte // filled from a live terminal, nil for scripted input
+	next  []byte    // taken off keys by a peek, or put back
+}
+
+func NewKeyboard(input io.Reader, live bool) *Keyboard {
+	k := &Keyboard{input: bufio.NewReader(input)}
+
+	if live {
+		k.keys = make(chan byte, 256)
+
+		go func() {
+			for {
+				char, err := k.input.ReadByte()
+				if err != nil {
+					close(k.keys)
+					return
+				}
+
+				k.keys <- char
+			}
+		}()
+	}
+
+	return k
+}
+
+// Read waits for the next key, false once input has run out.
+func (k *Keyboard) Read() (byte, bool) {
+	if len(k.next) > 0 {
+		char := k.next[0]
+		k.next = k.next[1:]
+		return char, true
+	}
+
+	if k.keys == nil {
+		char, err := k.input.ReadByte()
+		return char, err == nil
+	}
+
+	char, ok := <-k.keys
+	return char, ok
+}
+
+// Peek returns the next key without taking it or waiting for one, false
+// when none has been typed.
+func (k *Keyboard) Peek() (byte, bool) {
+	if len(k.next) > 0 {
+		return k.next[0], true
+	}
+
+	if k.keys == nil {
+		next, err := k.input.Peek(1)
+		if err != nil {
+			return 0, false
+		}
+		return next[0], true
+	}
+
+	select {
+	case char, ok := <-k.keys:
+		if !ok {
+			return 0, false
+		}
+
+		k.next = append(k.next, char)
+		return char, true
+
+	default:
+		return 0, false
+	}
+}
+
+// Unread puts a key back to be read next.
+func (k *Keyboard) Unread(char byte) {
+	k.next = append([]byte{char}, k.next...)
+}
+
+// Input is the reader under scripted input, for the debugger to share the
+// terminal with the program.
+func (k *Keyboard) Input() *bufio.Reader {
+	return k.input
+}
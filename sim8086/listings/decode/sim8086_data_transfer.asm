@@ -0,0 +1,62 @@
+; ========================================================================
+; Every form of the 8086 data transfer group, decoded: mov, push, pop,
+; xchg, in, out, xlat, lea, lds, les, lahf, sahf, pushf and popf.
+; ========================================================================
+
+bits 16
+
+; mov to and from segment registers
+mov es, ax
+mov ds, [bx+si+4]
+mov dx, cs
+mov [bp+di], ss
+
+; mov between the accumulator and memory
+mov al, [0x1234]
+mov ax, [0x10]
+mov [0x1234], al
+mov [0x10], ax
+
+; push and pop
+push word [bp+si]
+push word [0x20]
+push cx
+push es
+push cs
+push ss
+push ds
+pop word [bx+di+8]
+pop word [0x20]
+pop si
+pop es
+pop ss
+pop ds
+
+; xchg
+xchg ax, bx
+xchg cx, ax
+xchg al, dl
+xchg [bx], si
+xchg dh, [bp+di+0x100]
+
+; in and out, from a fixed port or dx
+in al, 0x60
+in ax, 0x40
+in al, dx
+in ax, dx
+out 0x43, al
+out 0x20, ax
+out dx, al
+out dx, ax
+
+xlat
+
+lea bx, [bp+si+6]
+lea ax, [0x100]
+lds si, [bx]
+les di, [bp+0x10]
+
+lahf
+sahf
+pushf
+popf
@@ -0,0 +1,60 @@
+; ========================================================================
+; Cycle estimates for the instructions beyond mov and add, run with
+; -mode cycles. Nothing executes, so every branch counts as not taken and
+; shifts by cl as shifting zero times.
+; ========================================================================
+
+bits 16
+
+test ax, bx
+test byte [bx], 1
+inc cx
+inc byte [si]
+dec dl
+neg ax
+not word [bp+2]
+shl ax, 1
+shr bl, cl
+sar word [di], 1
+rol dx, cl
+mul bl
+imul word [bx+si]
+div cx
+idiv byte [bp]
+push ax
+push ds
+push word [bx]
+pop cx
+pop word [si+4]
+xchg ax, dx
+xchg [bx], cx
+lea si, [bx+di+8]
+lds di, [bp+6]
+pushf
+popf
+lahf
+sahf
+cbw
+cwd
+clc
+stc
+cmc
+cld
+std
+cli
+sti
+xlat
+jz label
+loop label
+jcxz label
+label:
+jmp label
+call label
+call [bx]
+ret
+ret 4
+retf
+int 0x21
+int3
+into
+iret
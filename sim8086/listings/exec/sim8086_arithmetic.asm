@@ -0,0 +1,41 @@
+; ========================================================================
+; The arithmetic group: carries and borrows chained through adc and sbb,
+; inc and dec leaving the carry alone, neg, and the multiplies and divides
+; with the sign extensions that set them up.
+; ========================================================================
+
+bits 16
+
+; a 32-bit add and subtract in dx:ax
+mov ax, 0xffff
+add ax, 1
+adc dx, 0
+sub ax, 1
+sbb dx, 0
+
+stc
+inc ax
+dec cx
+neg cx
+
+mov al, 200
+mov bl, 3
+mul bl
+
+mov ax, -7
+mov bx, 3
+imul bx
+
+mov ax, 100
+mov dx, 0
+mov cx, 7
+div cx
+
+mov al, -100
+cbw
+cwd
+idiv cx
+
+mov ax, -9
+mov bl, 2
+idiv bl
@@ -0,0 +1,53 @@
+; ========================================================================
+; BIOS video and keyboard services from a .COM program, run with the keys
+; in sim8086_bios_console.input and the text screen shown at the end:
+; moving the cursor, teletype output wrapping at the right edge, reading keys
+; and peeking when none are left.
+; ========================================================================
+
+bits 16
+org 0x100
+
+; row 2, column 70
+mov ah, 0x02
+mov bh, 0
+mov dx, 0x0246
+int 0x10
+
+; past the right edge onto the next row
+mov si, message
+print:
+lodsb
+or al, al
+jz printed
+mov ah, 0x0e
+int 0x10
+jmp print
+printed:
+
+mov ah, 0x03
+mov bh, 0
+int 0x10
+mov di, dx
+
+; echo keys until enter
+echo:
+mov ah, 0x00
+int 0x16
+cmp al, 13
+je echoed
+mov ah, 0x0e
+int 0x10
+jmp echo
+echoed:
+
+; nothing left, so zero is set
+mov ah, 0x01
+int 0x16
+lahf
+mov bl, ah
+
+mov ax, 0x4c00
+int 0x21
+
+message: db "wrapping around", 13, 10, 0
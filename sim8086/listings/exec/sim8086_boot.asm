@@ -0,0 +1,37 @@
+; ========================================================================
+; A two sector disk image booted with -format boot: the boot sector, loaded
+; at 0000:7c00, resets the drive it was booted from, reads the second
+; sector to 0000:8000 through INT 13h and jumps to it, which stops with
+; interrupts off.
+; ========================================================================
+
+bits 16
+org 0x7c00
+
+mov ah, 0x00
+int 0x13
+
+; one sector from cylinder 0, head 0, sector 2 to es:bx
+mov ax, 0x0201
+mov cx, 0x0002
+mov dh, 0
+mov bx, 0x8000
+int 0x13
+jc failed
+
+jmp 0x0000:0x8000
+
+failed:
+mov di, ax
+cli
+hlt
+
+times 510 - ($ - $$) db 0
+dw 0xaa55
+
+second_sector:
+mov si, 0xbeef
+cli
+hlt
+
+times 1024 - ($ - $$) db 0
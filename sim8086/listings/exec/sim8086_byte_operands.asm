@@ -0,0 +1,29 @@
+; ========================================================================
+; Byte registers and byte memory: each half of ax, bx, cx and dx on its own,
+; byte arithmetic carrying out of the byte rather than into the other half,
+; and byte stores leaving the neighbouring byte alone.
+; ========================================================================
+
+bits 16
+
+mov ax, 0x1234
+mov al, 0xff
+mov ah, 0x01
+add al, 1
+adc ah, 0
+xchg al, ah
+mov bh, al
+mov bl, ah
+sub bl, 2
+mov ch, bl
+mov cl, bh
+neg cl
+mov dh, 0x80
+mov dl, dh
+shl dl, 1
+
+mov word [0x100], 0xabff
+inc byte [0x100]
+mov byte [0x101], 0x7f
+add byte [0x101], 1
+mov si, [0x100]
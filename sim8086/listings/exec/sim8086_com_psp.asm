@@ -0,0 +1,31 @@
+; ========================================================================
+; A .COM program looking at its program segment prefix, run with
+; -args "one two": the command tail at 80h, the top of memory at 02h and the
+; environment segment at 2ch, then exiting with code 7 through the far call
+; entry to DOS at 50h.
+; ========================================================================
+
+bits 16
+org 0x100
+
+; registers as DOS leaves them
+mov bx, sp
+mov dx, cs
+
+; length, first character and closing carriage return of the tail
+mov cl, [0x80]
+mov al, [0x82]
+mov si, cx
+mov ah, [0x81+si]
+
+mov di, [0x02]
+mov bp, [0x2c]
+
+; the environment ends with this program's path after a count of 1
+mov es, bp
+mov si, es:[0x02]
+
+mov word [0xf0], 0x50
+mov word [0xf2], cs
+mov ax, 0x4c07
+call far [0xf0]
@@ -0,0 +1,101 @@
+; ========================================================================
+; Every conditional jump after comparing -1 with 1, which is below as signed
+; and above as unsigned, then loop, loopz, loopnz and jcxz. si counts the
+; jumps not taken: jb, jg, jbe, jge, je, jns, jo and jp.
+; ========================================================================
+
+bits 16
+
+mov ax, -1
+mov bx, 1
+cmp ax, bx
+ja skip0
+inc si
+skip0:
+cmp ax, bx
+jb skip1
+inc si
+skip1:
+cmp ax, bx
+jl skip2
+inc si
+skip2:
+cmp ax, bx
+jg skip3
+inc si
+skip3:
+cmp ax, bx
+jae skip4
+inc si
+skip4:
+cmp ax, bx
+jbe skip5
+inc si
+skip5:
+cmp ax, bx
+jge skip6
+inc si
+skip6:
+cmp ax, bx
+jle skip7
+inc si
+skip7:
+cmp ax, bx
+je skip8
+inc si
+skip8:
+cmp ax, bx
+jne skip9
+inc si
+skip9:
+cmp ax, bx
+js skip10
+inc si
+skip10:
+cmp ax, bx
+jns skip11
+inc si
+skip11:
+cmp ax, bx
+jo skip12
+inc si
+skip12:
+cmp ax, bx
+jno skip13
+inc si
+skip13:
+cmp ax, bx
+jp skip14
+inc si
+skip14:
+cmp ax, bx
+jnp skip15
+inc si
+skip15:
+
+; three times round
+mov cx, 3
+count:
+inc dx
+loop count
+
+; stops at the first mismatch, with cx left at 3
+mov cx, 5
+match:
+inc di
+cmp di, 1
+loopz match
+
+; stops as soon as the bytes match, with cx left at 1
+mov cx, 4
+search:
+inc bp
+cmp bp, 3
+loopnz search
+
+jcxz not_taken
+mov cx, 0
+jcxz done
+not_taken:
+inc si
+done:
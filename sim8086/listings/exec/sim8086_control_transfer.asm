@@ -0,0 +1,59 @@
+; ========================================================================
+; Calls, returns, jumps and software interrupts: near calls direct and
+; through memory, ret popping arguments, a far call and retf, a far jump
+; through memory, and int and into reaching a handler installed in the
+; vector table, which iret returns from. It runs with -origin 0100:0000,
+; clear of the vector table, with ds still 0000.
+; ========================================================================
+
+bits 16
+
+; vector 40h and the overflow vector point at handler
+mov word [0x100], handler
+mov word [0x102], 0x0100
+mov word [0x10], handler
+mov word [0x12], 0x0100
+
+call near_proc
+
+mov word [0x200], near_proc
+mov bx, 0x200
+call [bx]
+
+mov ax, 7
+push ax
+call pops_argument
+
+call 0x0100:far_proc
+
+mov word [0x204], after
+mov word [0x206], 0x0100
+jmp far [0x204]
+mov dx, 0xdead
+
+after:
+int 0x40
+into
+mov al, 0x7f
+add al, 1
+into
+jmp done
+
+near_proc:
+inc cx
+ret
+
+pops_argument:
+mov bp, sp
+mov si, [bp+2]
+ret 2
+
+far_proc:
+inc di
+retf
+
+handler:
+inc dx
+iret
+
+done:
@@ -0,0 +1,65 @@
+; ========================================================================
+; INT 21h services from a .COM program, run with the keyboard scripted by
+; sim8086_dos_services.input and this directory as the sandbox: reading a
+; line and a character from the console, polling it once it's empty,
+; writing to it, hooking a vector, and reading a file.
+; ========================================================================
+
+bits 16
+org 0x100
+
+; a line through handle 0 comes back with its CR LF
+mov ah, 0x3f
+mov bx, 0
+mov cx, 80
+mov dx, line
+int 0x21
+mov si, ax
+
+; then one character, and nothing waiting after it
+mov ah, 0x01
+int 0x21
+mov bl, al
+mov ah, 0x06
+mov dl, 0xff
+int 0x21
+mov bh, al
+
+mov ah, 0x09
+mov dx, greeting
+int 0x21
+
+; point int 60h at handler, leaving int 21h where it was
+mov ax, 0x3521
+int 0x21
+mov di, bx
+mov ax, 0x2560
+mov dx, handler
+int 0x21
+int 0x60
+
+; the first four bytes of the input file
+mov ax, 0x3d00
+mov dx, file_name
+int 0x21
+mov bx, ax
+mov ah, 0x3f
+mov cx, 4
+mov dx, contents
+int 0x21
+mov ah, 0x3e
+int 0x21
+mov cx, [contents]
+mov dx, [contents+2]
+
+mov ax, 0x4c03
+int 0x21
+
+handler:
+inc bp
+iret
+
+greeting: db "Hello from DOS", 13, 10, "$"
+file_name: db "sim8086_dos_services.input", 0
+line: times 80 db 0
+contents: dw 0, 0
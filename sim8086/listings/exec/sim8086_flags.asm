@@ -0,0 +1,61 @@
+; ========================================================================
+; The whole flags register: auxiliary carry and overflow from adds, the
+; control flags set and cleared directly, lahf and sahf, pushf and popf,
+; and the trap flag single stepping through a handler on vector 1, which
+; counts the steps in bp. It runs with -origin 0100:0000, clear of the
+; vector table.
+; ========================================================================
+
+bits 16
+
+mov word [0x04], trap
+mov word [0x06], 0x0100
+mov sp, 0x1000
+
+mov al, 0x0f
+add al, 1
+mov ax, 0x7fff
+add ax, 1
+std
+sti
+cld
+cli
+
+; carry, parity and sign into ah and back out of it
+mov ah, 0x85
+sahf
+lahf
+mov dl, ah
+
+; every flag but trap and interrupt popped and pushed back, the unused
+; bits reading as the 8086 has them
+mov ax, 0xfcff
+push ax
+popf
+pushf
+pop cx
+
+; three instructions single stepped
+xor ax, ax
+push ax
+popf
+pushf
+pop ax
+or ax, 0x0100
+push ax
+popf
+inc si
+inc si
+inc si
+pushf
+pop ax
+and ax, 0xfeff
+push ax
+popf
+jmp done
+
+trap:
+inc bp
+iret
+
+done:
@@ -0,0 +1,33 @@
+; ========================================================================
+; Logic, shift and rotate instructions: and, or, xor and test clearing
+; carry and overflow, not leaving the flags alone, shifts by one and by cl,
+; and rotates through and around the carry.
+; ========================================================================
+
+bits 16
+
+mov ax, 0x0ff0
+mov bx, 0x3c3c
+and ax, bx
+or ax, 0x8001
+xor bx, bx
+test ax, 0x8000
+not ax
+
+mov dx, 0x8001
+shl dx, 1
+shr dx, 1
+mov cl, 4
+mov si, 0xf000
+sar si, cl
+shr si, cl
+
+mov al, 0x81
+rol al, 1
+ror al, 1
+stc
+rcl al, 1
+rcr al, 1
+mov bl, 0x96
+mov cl, 3
+rol bl, cl
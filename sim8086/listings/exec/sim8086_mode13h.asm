@@ -0,0 +1,38 @@
+; ========================================================================
+; Drawing in mode 13h from a .COM program: a pixel plotted through the
+; BIOS, a row stored straight into a000:0000, and palette entry 1 changed
+; to orange through the DAC. framebuffer_test.go checks the PNG it makes.
+; ========================================================================
+
+bits 16
+org 0x100
+
+mov ax, 0x0013
+int 0x10
+
+; colour 4 at column 10, row 20
+mov ax, 0x0c04
+mov cx, 10
+mov dx, 20
+int 0x10
+
+; all of row 100 in colour 1
+mov ax, 0xa000
+mov es, ax
+mov di, 100 * 320
+mov cx, 320
+mov al, 1
+rep stosb
+
+mov dx, 0x3c8
+out dx, al
+mov dx, 0x3c9
+mov al, 63
+out dx, al
+mov al, 32
+out dx, al
+mov al, 0
+out dx, al
+
+mov ax, 0x4c00
+int 0x21
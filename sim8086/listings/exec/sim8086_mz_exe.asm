@@ -0,0 +1,50 @@
+; ========================================================================
+; An MZ executable built by hand: a two paragraph header with one
+; relocation, a code segment that loads its data segment's address, fixed
+; up by the loader, and a stack segment of its own.
+; ========================================================================
+
+bits 16
+
+header:
+db "MZ"
+dw (file_end - header) % 512
+dw (file_end - header + 511) / 512
+dw 1                            ; relocations
+dw (image - header) / 16        ; header paragraphs
+dw 0x10                         ; minimum paragraphs beyond the image
+dw 0xffff                       ; maximum
+dw (stack - image) / 16         ; ss
+dw 0x100                        ; sp
+dw 0                            ; checksum
+dw start - image                ; ip
+dw 0                            ; cs
+dw relocations - header
+dw 0                            ; overlay
+
+relocations:
+dw fixup - image - 2, 0
+
+times 32 - ($ - header) db 0
+
+image:
+start:
+mov ax, (data - image) / 16
+fixup:
+mov ds, ax
+mov si, [0]
+mov di, [2]
+mov bx, ss
+mov cx, sp
+mov ax, 0x4c00
+int 0x21
+
+times 32 - ($ - start) db 0
+
+data:
+dw 0x1234, 0x5678
+
+times 16 - ($ - data) db 0
+
+stack:
+file_end:
@@ -0,0 +1,66 @@
+; ========================================================================
+; The port bus: the timer counting down between two latched reads of
+; channel 2, the interrupt controller's mask read back, the VGA palette
+; written and read a component at a time, the serial port's line status,
+; and a port nothing answers floating high.
+; ========================================================================
+
+bits 16
+
+; channel 2, low then high byte, mode 2 with a reload of 1000
+mov al, 0xb4
+out 0x43, al
+mov ax, 1000
+out 0x42, al
+mov al, ah
+out 0x42, al
+
+; latch and read it twice, some instructions apart
+mov al, 0x80
+out 0x43, al
+in al, 0x42
+mov bl, al
+in al, 0x42
+mov bh, al
+mov cx, 10
+wait:
+loop wait
+mov al, 0x80
+out 0x43, al
+in al, 0x42
+mov cl, al
+in al, 0x42
+mov ch, al
+
+mov al, 0xfd
+out 0x21, al
+in al, 0x21
+mov [0x200], al
+
+; palette entry 5 becomes 10, 20, 30
+mov al, 5
+mov dx, 0x3c8
+out dx, al
+mov dx, 0x3c9
+mov al, 10
+out dx, al
+mov al, 20
+out dx, al
+mov al, 30
+out dx, al
+mov al, 5
+mov dx, 0x3c7
+out dx, al
+mov dx, 0x3c9
+in al, dx
+mov ah, al
+in al, dx
+mov si, ax
+in al, dx
+mov di, ax
+
+mov dx, 0x3fd
+in al, dx
+mov bp, ax
+
+in ax, 0x80
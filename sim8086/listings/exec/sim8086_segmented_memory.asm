@@ -0,0 +1,35 @@
+; ========================================================================
+; The 1 MB segmented address space: different segment:offset pairs naming
+; the same byte, effective addresses wrapping within their segment, a word
+; at offset 0xffff taking its high byte from the start of the segment, and
+; ffff:0010 and up wrapping around to the bottom of memory.
+; ========================================================================
+
+bits 16
+
+; 1234:0010 and 1235:0000 are both 12350
+mov ax, 0x1234
+mov ds, ax
+mov byte [0x10], 0x5a
+mov ax, 0x1235
+mov es, ax
+mov bl, es:[0]
+
+; bx+si past 0xffff wraps to 0x0002 in the segment
+mov bx, 0xfffe
+mov si, 4
+mov byte [bx+si], 0x77
+mov cl, [2]
+
+; a word at the very end of the segment
+mov word [0xffff], 0x1122
+mov dl, [0]
+mov dh, [0xffff]
+
+; ffff:0100 is 000f0, past the top of memory
+mov ax, 0xffff
+mov es, ax
+mov word es:[0x100], 0xbeef
+xor ax, ax
+mov es, ax
+mov bp, es:[0xf0]
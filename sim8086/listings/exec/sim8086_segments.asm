@@ -0,0 +1,32 @@
+; ========================================================================
+; Segment registers and overrides: moving segment registers to and from
+; general registers and memory, pushing and popping them, and the same
+; offset read through ds, es, cs and ss.
+; ========================================================================
+
+bits 16
+
+mov ax, 0x0100
+mov es, ax
+mov bx, es
+mov ax, 0x0200
+mov ss, ax
+mov sp, 0x10
+push es
+pop ds
+mov ax, 0x0300
+mov es, ax
+
+; four different bytes at offset 0x80, one in each segment, cs being
+; this code
+mov byte [0x80], 1
+mov byte es:[0x80], 2
+mov byte ss:[0x80], 3
+mov byte cs:[0x80], 4
+
+mov bp, 0x80
+mov al, [bp]
+mov ah, ds:[bp]
+mov cl, cs:[0x80]
+mov word [0x90], ss
+mov dx, [0x90]
@@ -0,0 +1,29 @@
+; ========================================================================
+; Code is fetched from memory as it runs: an instruction rewritten ahead of
+; itself runs as rewritten, and a routine copied elsewhere in memory runs
+; from its copy. It runs as a .COM program, which unlike a raw binary
+; doesn't end on leaving its image.
+; ========================================================================
+
+bits 16
+org 0x100
+
+; the immediate of the mov below becomes 5
+mov byte [patch+1], 5
+patch:
+mov cx, 1
+
+; copy routine to 0x300 and call it there twice
+mov si, routine
+mov di, 0x300
+mov cx, routine_end - routine
+rep movsb
+mov ax, 0x300
+call ax
+call ax
+ret
+
+routine:
+add dx, 3
+ret
+routine_end:
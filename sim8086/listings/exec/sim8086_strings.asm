@@ -0,0 +1,40 @@
+; ========================================================================
+; String instructions under rep, repe and repne: copying a block forwards
+; with movsb, searching it with scasb, comparing it with cmpsb until the
+; first difference, and filling words backwards with the direction flag set.
+; ========================================================================
+
+bits 16
+
+jmp start
+
+source: db "sim8086"
+
+start:
+mov si, source
+mov di, 0x100
+mov cx, 7
+cld
+rep movsb
+
+; find the '8'
+mov di, 0x100
+mov al, '8'
+mov cx, 7
+repne scasb
+
+; compare until the copy differs
+mov byte [0x104], 'X'
+mov si, source
+mov di, 0x100
+mov cx, 7
+repe cmpsb
+
+; two words backwards from 0x112
+std
+mov di, 0x112
+mov ax, 0xabcd
+mov cx, 2
+rep stosw
+lodsb
+cld
@@ -0,0 +1,45 @@
+; ========================================================================
+; Writing characters and attributes straight into the text screen at
+; b800:0000 from a .COM program, shown at the end: bright and blinking
+; attributes, line drawing and control code glyphs, and an attribute
+; changed on its own by a byte store.
+; ========================================================================
+
+bits 16
+org 0x100
+
+mov ax, 0xb800
+mov es, ax
+
+; bright white on blue at the top left
+mov di, 0
+mov ah, 0x1f
+mov al, 'H'
+stosw
+mov al, 'i'
+stosw
+mov al, 0x01
+stosw
+
+; a double line box top on the second row, yellow on black
+mov di, 160
+mov ax, 0x0ec9
+stosw
+mov al, 0xcd
+mov cx, 6
+rep stosw
+mov al, 0xbb
+stosw
+
+; blinking red on grey on the third row
+mov di, 320
+mov ax, 0xf441
+stosw
+mov al, 'B'
+stosw
+
+; only the attribute of the first character changes, to green on black
+mov byte [es:1], 0x02
+
+mov ax, 0x4c00
+int 0x21
@@ -0,0 +1,45 @@
+; ========================================================================
+; Timer interrupts on the simulated clock: the interrupt controller set up
+; for vectors 8 and up with only IRQ 0 unmasked, timer channel 0 firing
+; every 100 ticks, and hlt waiting for each interrupt. The handler counts
+; them in dx. It runs with -origin 0100:0000, clear of the vector table.
+; ========================================================================
+
+bits 16
+
+mov word [0x20], tick
+mov word [0x22], 0x0100
+mov sp, 0x1000
+
+; edge triggered, single, ICW4 needed; base 8; 8086 mode; mask all but 0
+mov al, 0x13
+out 0x20, al
+mov al, 0x08
+out 0x21, al
+mov al, 0x01
+out 0x21, al
+mov al, 0xfe
+out 0x21, al
+
+; channel 0, mode 2, a reload of 100
+mov al, 0x34
+out 0x43, al
+mov al, 100
+out 0x40, al
+mov al, 0
+out 0x40, al
+
+sti
+hlt
+hlt
+hlt
+cli
+jmp done
+
+tick:
+inc dx
+mov al, 0x20
+out 0x20, al
+iret
+
+done:
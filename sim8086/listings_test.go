@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listingArgs are the options a listing runs with beyond its directory's:
+// decode listings are decoded and exec ones executed.
+var listingArgs = map[string][]string{
+	"listing_0056_estimating_cycles": {"-mode", "cycles"},
+	"sim8086_more_cycle_estimates":   {"-mode", "cycles"},
+	"sim8086_control_transfer":       {"-origin", "0100:0000"},
+	"sim8086_flags":                  {"-origin", "0100:0000"},
+	"sim8086_timer_interrupts":       {"-origin", "0100:0000"},
+	"sim8086_self_modifying":         {"-format", "com"},
+	"sim8086_boot":                   {"-format", "boot"},
+	"sim8086_com_psp":                {"-format", "com", "-args", "one two"},
+	"sim8086_mode13h":                {"-format", "com"},
+	"sim8086_text_screen":            {"-format", "com", "-screen", "end"},
+	"sim8086_bios_console": {
+		"-format", "com", "-input", "listings/exec/sim8086_bios_console.input", "-screen", "end",
+	},
+	"sim8086_dos_services": {
+		"-format", "com", "-input", "listings/exec/sim8086_dos_services.input", "-sandbox", "listings/exec",
+	},
+}
+
+// TestListings checks every listing's output against the .txt next to it.
+func TestListings(t *testing.T) {
+	for _, mode := range []string{"decode", "exec"} {
+		sources, err := filepath.Glob(filepath.Join("listings", mode, "*.asm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, source := range sources {
+			path := strings.TrimSuffix(source, ".asm")
+			name := filepath.Base(path)
+
+			t.Run(name, func(t *testing.T) {
+				want, err := os.ReadFile(path + ".txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				args := append([]string{"-mode", mode, "-path", path}, listingArgs[name]...)
+				got, _ := simulate(t, args...)
+
+				if got != string(want) {
+					t.Error(firstDifference(got, string(want)))
+				}
+			})
+		}
+	}
+}
+
+func firstDifference(got, want string) string {
+	gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+
+	for i := range max(len(gotLines), len(wantLines)) {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+
+		if g != w {
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, g, w)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Image is the memory range a program was loaded into.
+type Image struct {
+	Start uint32
+	End   uint32
+}
+
+func (image Image) Contains(address uint32) bool {
+	return address >= image.Start && address < image.End
+}
+
+// LoadRaw copies a flat binary to segment:offset and points cs:ip at its
+// first byte. The copy is linear, so an image over 64K carries on past the
+// end of the segment for far jumps to reach.
+func LoadRaw(buff []byte, memory Memory, registers Registers, segment, offset uint16) Image {
+	start := PhysicalAddress(segment, offset)
+	for i, b := range buff {
+		memory[(start+uint32(i))%MemorySize] = b
+	}
+
+	registers[RI_cs] = int16(segment)
+	registers[RI_ip] = int16(offset)
+
+	return Image{start, start + uint32(len(buff))}
+}
+
+// ParseSegmentOffset reads a "ssss:oooo" hex address.
+func ParseSegmentOffset(value string) (segment uint16, offset uint16, err error) {
+	if _, err = fmt.Sscanf(value, "%x:%x", &segment, &offset); err != nil {
+		return 0, 0, fmt.Errorf("bad address %q, expected segment:offset in hex", value)
+	}
+
+	return segment, offset, nil
+}
+
+// LoadCom loads a .COM program the way DOS does: the PSP at segment:0000 and
+// the code at segment:0100, with every segment register on the PSP. The stack
+// starts at the top of the segment holding a zero word, so a final ret lands
+// on the int 20h at the start of the PSP.
+func LoadCom(buff []byte, memory Memory, registers Registers, segment uint16, program string, arguments string) (Image, error) {
+	if len(buff) > 0x10000-0x100-2 {
+		return Image{}, fmt.Errorf("%d bytes is too large for a .COM program", len(buff))
+	}
+
+	BuildPsp(memory, segment, program, arguments)
+	image := LoadRaw(buff, memory, registers, segment, 0x100)
+
+	registers[RI_ds] = int16(segment)
+	registers[RI_es] = int16(segment)
+	registers[RI_ss] = int16(segment)
+	registers[RI_sp] = 0
+	Push(0, registers, memory)
+
+	return image, nil
+}
+
+// MzHeader is the fixed part of a DOS .EXE header.
+type MzHeader struct {
+	Signature        [2]byte
+	LastPageBytes    uint16
+	Pages            uint16
+	Relocations      uint16
+	HeaderParagraphs uint16
+	MinAlloc         uint16
+	MaxAlloc         uint16
+	SS               uint16
+	SP               uint16
+	Checksum         uint16
+	IP               uint16
+	CS               uint16
+	RelocationTable  uint16
+	Overlay          uint16
+}
+
+func IsMz(buff []byte) bool {
+	return len(buff) >= 2 && (string(buff[:2]) == "MZ" || string(buff[:2]) == "ZM")
+}
+
+// LoadExe loads an MZ executable after a PSP at segment:0000. The load module
+// goes to the following paragraph, every relocation gets that segment added,
+// and cs:ip and ss:sp come from the header relative to it.
+func LoadExe(buff []byte, memory Memory, registers Registers, segment uint16, program string, arguments string) (Image, error) {
+	var header MzHeader
+	if err := binary.Read(bytes.NewReader(buff), binary.LittleEndian, &header); err != nil || !IsMz(buff) {
+		return Image{}, errors.New("not an MZ executable")
+	}
+
+	fileSize := int(header.Pages) * 512
+	if header.LastPageBytes != 0 {
+		fileSize -= 512 - int(header.LastPageBytes)
+	}
+
+	start := int(header.HeaderParagraphs) * 16
+	if fileSize > len(buff) || start > fileSize {
+		return Image{}, errors.New("truncated MZ executable")
+	}
+
+	module := buff[start:fileSize]
+	loadSegment := segment + 0x10
+
+	if uint32(loadSegment)*16+uint32(len(module)) > 0xa0000 {
+		return Image{}, fmt.Errorf("%d bytes doesn't fit in conventional memory", len(module))
+	}
+
+	BuildPsp(memory, segment, program, arguments)
+	image := LoadRaw(module, memory, registers, loadSegment, 0)
+
+	table := int(header.RelocationTable)
+	for i := range int(header.Relocations) {
+		entry := table + i*4
+		if entry+4 > len(buff) {
+			return Image{}, errors.New("truncated MZ relocation table")
+		}
+
+		offset := binary.LittleEndian.Uint16(buff[entry:])
+		fixupSegment := loadSegment + binary.LittleEndian.Uint16(buff[entry+2:])
+		memory.Store(fixupSegment, offset, memory.Load(fixupSegment, offset, true)+loadSegment, true)
+	}
+
+	registers[RI_cs] = int16(loadSegment + header.CS)
+	registers[RI_ip] = int16(header.IP)
+	registers[RI_ss] = int16(loadSegment + header.SS)
+	registers[RI_sp] = int16(header.SP)
+	registers[RI_ds] = int16(segment)
+	registers[RI_es] = int16(segment)
+
+	return image, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bigImage is a raw program over 64K: a far jump from the start to mov ax, 1
+// just past the first 64K, with nops in between.
+func bigImage(t *testing.T) string {
+	t.Helper()
+
+	image := make([]byte, 0x10004)
+	for i := range image {
+		image[i] = 0x90
+	}
+	copy(image, []byte{0xea, 0x00, 0x00, 0x00, 0x10}) // jmp 1000:0000
+	copy(image[0x10000:], []byte{0xb8, 0x01, 0x00})   // mov ax, 1
+
+	path := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadRawOver64K(t *testing.T) {
+	buff := make([]byte, 0x10010)
+	buff[0], buff[0x10000] = 0x11, 0x22
+
+	memory := make(Memory, MemorySize)
+	registers := make(Registers, RI_Count)
+	image := LoadRaw(buff, memory, registers, 0x2000, 0x0010)
+
+	if memory[0x20010] != 0x11 || memory[0x30010] != 0x22 {
+		t.Errorf("image starts %02x and has %02x at 64K", memory[0x20010], memory[0x30010])
+	}
+	if image.Start != 0x20010 || image.End != 0x30020 {
+		t.Errorf("image is %05x-%05x", image.Start, image.End)
+	}
+}
+
+func TestDecodeOver64K(t *testing.T) {
+	stdout, _ := simulate(t, "-mode", "decode", "-path", bigImage(t))
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 1+1+0x10000-5+2 {
+		t.Errorf("decoded %d lines", len(lines))
+	}
+	if lines[1] != "jmp 4096:0" {
+		t.Errorf("decoding starts with %q", lines[1])
+	}
+	if last := lines[len(lines)-2:]; last[0] != "mov ax, word 1" || last[1] != "nop" {
+		t.Errorf("decoding ends with %q", last)
+	}
+}
+
+func TestExecuteOver64K(t *testing.T) {
+	stdout, _ := simulate(t, "-mode", "exec", "-path", bigImage(t))
+
+	if !strings.Contains(stdout, ";   ax: 0x0001 (1)\n;   cs: 0x1000 (4096)\n") {
+		t.Errorf("the code past 64K didn't run:\n%s", stdout)
+	}
+}
@@ -1,20 +1,57 @@
 package main
 
 import (
+	"bufio"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 var mode string
 var dump string
 var filePath string
+var origin string
+var format string
+var arguments string
+var sandbox string
+var input string
+var console string
+var uart string
+var pngPath string
+var pngFormat string
+var pngOrigin string
+var pngSize string
+var pngEvery int
+var screen string
+var gdbAddress string
+var traceFormat string
+var traceOut string
 
 func init() {
-	flag.StringVar(&mode, "mode", "decode", "command mode - [exec, decode, cycles]")
+	flag.StringVar(&mode, "mode", "decode", "command mode - [exec, decode, cycles, debug, gdb]")
 	flag.StringVar(&dump, "dump", "", "file path for memory dump")
 	flag.StringVar(&filePath, "path", "", "file path to asm binary")
+	flag.StringVar(&origin, "origin", "", "cs:ip the binary is loaded at, in hex; the segment of the PSP for DOS programs (default 0000:0000, 1000:0000 for DOS, 0000:7c00 for boot)")
+	flag.StringVar(&format, "format", "", "binary format - [raw, com, exe, boot] (default guessed from the MZ signature and file extension)")
+	flag.StringVar(&arguments, "args", "", "command tail passed to a DOS program")
+	flag.StringVar(&sandbox, "sandbox", "", "directory DOS programs can open files in (default none)")
+	flag.StringVar(&input, "input", "", "file scripting the keyboard, instead of the terminal")
+	flag.StringVar(&console, "console", "", "file the program's console output goes to (default stderr, away from the trace)")
+	flag.StringVar(&uart, "uart", "", "file the serial port transmits to (default the console)")
+	flag.StringVar(&pngPath, "png", "", "file path for a PNG of the framebuffer at the end")
+	flag.StringVar(&pngFormat, "png-format", "mode13h", "framebuffer pixels - [mode13h, cga4, cga6, rgba] (cga4 and cga6 are modes 04h and 06h)")
+	flag.StringVar(&pngOrigin, "png-origin", "", "framebuffer address, in hex (default a000:0000 for mode13h, b800:0000 for cga4 and cga6, 0000:0000 for rgba)")
+	flag.StringVar(&pngSize, "png-size", "", "framebuffer size in pixels (default 640x200 for cga6, 320x200 otherwise)")
+	flag.IntVar(&pngEvery, "png-every", 0, "also write a numbered PNG frame every N instructions")
+	flag.StringVar(&screen, "screen", "", "show the b800:0000 text screen - [end, live] (live redraws it on stderr as it changes)")
+	flag.StringVar(&gdbAddress, "gdb", "localhost:1234", "address gdb connects to in gdb mode")
+	flag.StringVar(&traceFormat, "trace", "text", "trace format - [text, json] (json writes an object a line, a step for each instruction and then how the program ended)")
+	flag.StringVar(&traceOut, "trace-out", "", "file the trace goes to (default stdout)")
 }
 
 func main() {
@@ -26,39 +63,303 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Println("bits 16")
+	// like DOS, trust the signature over the extension
+	if format == "" {
+		format = "raw"
+		if IsMz(buff) {
+			format = "exe"
+		} else if strings.EqualFold(filepath.Ext(filePath), ".com") {
+			format = "com"
+		} else if strings.EqualFold(filepath.Ext(filePath), ".img") {
+			format = "boot"
+		}
+	}
+
+	if origin == "" {
+		origin = "0000:0000"
+		if format == "com" || format == "exe" {
+			origin = "1000:0000"
+		}
+		if format == "boot" {
+			origin = "0000:7c00"
+		}
+	}
+
+	segment, offset, err := ParseSegmentOffset(origin)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if (format == "com" || format == "exe") && segment < LowestPspSegment {
+		fmt.Printf("origin %s is too low for a DOS program, the PSP segment has to be %04x or above\n", origin, LowestPspSegment)
+		os.Exit(2)
+	}
+
+	Sandbox = sandbox
+
+	if input != "" {
+		file, err := os.Open(input)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		ConsoleInput = NewKeyboard(file, false)
+	} else if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 && mode != "debug" {
+		// typed keys are buffered as they come, unless the debugger is
+		// reading its commands from the same terminal
+		ConsoleInput = NewKeyboard(os.Stdin, true)
+	}
+
+	if console != "" {
+		file, err := os.Create(console)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		Console = file
+	}
+
+	serial := Console
+	if uart != "" {
+		file, err := os.Create(uart)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
 
-	memory := make(Memory, (2<<15)-1)
+		serial = file
+	}
+
+	InstallDevices(serial)
+
+	framebuffer, err := parseFramebuffer()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if traceFormat != "text" && traceFormat != "json" {
+		fmt.Printf("unknown trace format %q\n", traceFormat)
+		os.Exit(2)
+	}
+	TraceFormat = traceFormat
+	StoreHooks = append(StoreHooks, TraceStore)
+
+	if traceOut != "" {
+		file, err := os.Create(traceOut)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+
+		Trace = file
+	}
+
+	// anything else that would be printed goes with a text trace, and out of
+	// the way of a JSON one so every line of that is an event
+	var diagnostics io.Writer = Trace
+	if TraceFormat == "json" {
+		diagnostics = os.Stderr
+	}
+
+	textScreen := &TextScreen{Output: diagnostics}
+	switch screen {
+	case "", "end":
+	case "live":
+		// away from the trace, so it can be redirected
+		textScreen.Output = os.Stderr
+		StoreHooks = append(StoreHooks, textScreen.Watch)
+	default:
+		fmt.Printf("unknown screen option %q\n", screen)
+		os.Exit(2)
+	}
+
+	// a JSON trace is only events
+	if TraceFormat == "text" {
+		fmt.Fprintln(Trace, "bits 16")
+	}
+
+	memory := make(Memory, MemorySize)
 	registers := make(Registers, RI_Count)
 	cycles := 0
+	exitCode := 0
+	executed := 0
+	frames := 0
+
+	var image Image
+	switch format {
+	case "raw":
+		image = LoadRaw(buff, memory, registers, segment, offset)
+
+	case "com":
+		InstallDos(memory)
+		image, err = LoadCom(buff, memory, registers, segment, filePath, arguments)
+
+	case "exe":
+		InstallDos(memory)
+		image, err = LoadExe(buff, memory, registers, segment, filePath, arguments)
+
+	case "boot":
+		// the image is the disk, the BIOS starts its first sector
+		InstallBios(memory)
+		disk := NewDisk(buff)
+		InstallDisk(disk)
+		image, err = LoadBoot(disk, memory, registers, segment, offset)
+
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
 
-	for int(registers[RI_ip]) < len(buff) {
-		instruction, err := DecodeInstruction(int(registers[RI_ip]), buff)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	executing := mode == "exec" || mode == "debug" || mode == "gdb"
+
+	// step runs one instruction and whatever the hardware does around it,
+	// and reports whether the program is over
+	step := func() bool {
+		// instructions come from memory, so the program can rewrite itself
+		address := PhysicalAddress(uint16(registers[RI_cs]), uint16(registers[RI_ip]))
+
+		// a raw binary ends where it runs off its image, DOS programs exit
+		if (!executing || format == "raw") && !image.Contains(address) {
+			WriteTraceEnd(nil)
+			return true
+		}
+
+		if executing {
+			if err := RunInterruptHandler(registers, memory); err != nil {
+				var exit ProgramExit
+				if errors.As(err, &exit) {
+					exitCode = int(exit.Code)
+				}
+
+				WriteTraceEnd(err)
+				return true
+			}
+		}
+
+		instruction, err := DecodeInstruction(0, memory.Fetch(uint16(registers[RI_cs]), uint16(registers[RI_ip])))
 
 		if err != nil {
-			fmt.Println(";", err)
-			break
+			WriteTraceEnd(err)
+			return true
+		}
+
+		event := BeginTrace(instruction, address, registers, memory)
+
+		// the instruction is written out once it's done, ahead of any error
+		finish := func() {
+			event.End(registers)
+			event.Write(mode == "cycles")
 		}
 
 		registers[RI_ip] += int16(instruction.Size)
+
+		// decoding reads the image straight through, into the next 64K
+		// rather than round to the start of the segment
+		if !executing && uint16(registers[RI_ip]) < uint16(instruction.Size) {
+			registers[RI_cs] += 0x1000
+		}
+
+		if executing {
+			err := ExecuteIntruction(instruction, registers, memory)
+			event.Executed(registers)
+
+			// hlt lets time pass until a device interrupts
+			if errors.Is(err, ErrHalt) {
+				waited, ok := WaitForInterrupt(registers)
+				cycles += waited
+				if ok {
+					err = nil
+				}
+			}
+
+			if err != nil {
+				finish()
+				WriteTraceEnd(err)
+				return true
+			}
+		}
+
+		// estimated after execution, repeated string ops depend on it; the
+		// running total is the clock devices keep time by
 		cycles += instruction.EstimateCycles()
+		Ports.Tick(instruction.EstimateCycles())
+		event.Cycles, event.Total = instruction.EstimateCycles(), cycles
+
+		// hardware interrupts are recognised between instructions
+		if executing && !InterruptShadow(instruction) {
+			taken, err := HardwareInterrupt(registers, memory)
+			if err != nil {
+				finish()
+				WriteTraceEnd(err)
+				return true
+			}
+
+			if taken {
+				cycles += interruptCycles
+				Ports.Tick(interruptCycles)
+			}
+		}
+
+		finish()
+
+		if screen == "live" {
+			textScreen.Refresh(memory)
+		}
+
+		executed++
+		if pngPath != "" && pngEvery > 0 && executed%pngEvery == 0 {
+			frames++
+			if err := framebuffer.WritePng(FramePath(pngPath, frames), memory); err != nil {
+				WriteTraceEnd(err)
+				return true
+			}
+		}
 
-		fmt.Println(instruction.String())
+		return false
+	}
 
-		if mode == "cycles" {
-			fmt.Printf("; cycles +%d = %d\n", instruction.EstimateCycles(), cycles)
+	if mode == "debug" {
+		// the program's keyboard comes from the terminal too unless scripted
+		commands := ConsoleInput.Input()
+		if input != "" {
+			commands = bufio.NewReader(os.Stdin)
 		}
 
-		if mode == "exec" {
-			ExecuteIntruction(*instruction, registers, memory)
+		NewDebugger(step, registers, memory, commands).Run()
+	} else if mode == "gdb" {
+		server := NewGdbServer(step, func() int { return exitCode }, registers, memory)
+		if err := server.Serve(gdbAddress); err != nil {
+			fmt.Fprintln(diagnostics, ";", err)
+		}
+	} else {
+		for !step() {
 		}
 	}
 
-	if mode == "exec" {
-		fmt.Println()
+	if executing && TraceFormat == "text" {
+		fmt.Fprintln(Trace)
 		registers.Print()
 	}
 
+	if screen == "end" {
+		fmt.Fprintln(diagnostics)
+		textScreen.Draw(memory)
+	}
+
+	if pngPath != "" {
+		if err := framebuffer.WritePng(pngPath, memory); err != nil {
+			fmt.Fprintln(diagnostics, ";", err)
+		}
+	}
+
 	if dump != "" {
 		file, err := os.Create(dump)
 		if err != nil {
@@ -67,4 +368,45 @@ func main() {
 
 		binary.Write(file, binary.BigEndian, memory)
 	}
+
+	os.Exit(exitCode)
+}
+
+func parseFramebuffer() (Framebuffer, error) {
+	fb := Framebuffer{Format: pngFormat}
+
+	origin := pngOrigin
+	switch pngFormat {
+	case "mode13h":
+		if origin == "" {
+			origin = "a000:0000"
+		}
+	case "cga4", "cga6":
+		if origin == "" {
+			origin = "b800:0000"
+		}
+	case "rgba":
+		if origin == "" {
+			origin = "0000:0000"
+		}
+	default:
+		return fb, fmt.Errorf("unknown framebuffer format %q", pngFormat)
+	}
+
+	var err error
+	if fb.Segment, fb.Offset, err = ParseSegmentOffset(origin); err != nil {
+		return fb, err
+	}
+
+	size := pngSize
+	if size == "" {
+		size = "320x200"
+		if pngFormat == "cga6" {
+			size = "640x200"
+		}
+	}
+
+	fb.Width, fb.Height, err = ParseSize(size)
+
+	return fb, err
 }
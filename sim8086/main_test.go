@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for the simulator, so tests run it
+// on programs the same way the listings' expected output was made.
+func TestMain(m *testing.M) {
+	if os.Getenv("SIM8086_MAIN") != "" {
+		main()
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// simulate runs the simulator with args, giving back its stdout and stderr.
+// Programs can exit with any code, but the simulator refusing to start fails
+// the test.
+func simulate(t *testing.T, args ...string) (stdout, stderr string) {
+	t.Helper()
+
+	return simulateInput(t, "", args...)
+}
+
+// simulateInput is simulate with input on stdin, for the debugger.
+func simulateInput(t *testing.T, input string, args ...string) (stdout, stderr string) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "SIM8086_MAIN=1")
+	cmd.Stdin = strings.NewReader(input)
+
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+
+	var exit *exec.ExitError
+	if err := cmd.Run(); err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	} else if exit != nil && exit.ExitCode() == 2 {
+		t.Fatalf("sim8086 %q: %s%s", args, out.String(), errOut.String())
+	}
+
+	return out.String(), errOut.String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+type Memory []byte
+
+// MemorySize is the 1 MB reachable through the 20-bit address bus.
+const MemorySize = 1 << 20
+
+// PhysicalAddress forms a 20-bit address from segment:offset, wrapping around
+// at 1 MB the way the 8086 does.
+func PhysicalAddress(segment, offset uint16) uint32 {
+	return (uint32(segment)<<4 + uint32(offset)) & (MemorySize - 1)
+}
+
+// Load reads a byte or a little-endian word. The high byte of a word at offset
+// 0xffff comes from the start of the same segment.
+func (memory Memory) Load(segment, offset uint16, wide bool) uint16 {
+	value := uint16(memory[PhysicalAddress(segment, offset)])
+	if wide {
+		value |= uint16(memory[PhysicalAddress(segment, offset+1)]) << 8
+	}
+
+	return value
+}
+
+func (memory Memory) Store(segment, offset uint16, value uint16, wide bool) {
+	memory.storeByte(PhysicalAddress(segment, offset), byte(value))
+	if wide {
+		memory.storeByte(PhysicalAddress(segment, offset+1), byte(value>>8))
+	}
+}
+
+// fetchWindow covers the longest instruction and a generous run of prefixes.
+const fetchWindow = 16
+
+// Fetch copies out the bytes an instruction at segment:offset can span, for
+// DecodeInstruction. Like the CPU's prefetch they wrap within the segment, so
+// code at the top of a segment or of memory decodes rather than running off.
+func (memory Memory) Fetch(segment, offset uint16) []byte {
+	window := make([]byte, fetchWindow)
+	for i := range window {
+		window[i] = memory[PhysicalAddress(segment, offset+uint16(i))]
+	}
+
+	return window
+}
+
+// StoreHook is told about every byte stored, before it replaces old.
+type StoreHook func(address uint32, old, value byte)
+
+var StoreHooks []StoreHook
+
+func (memory Memory) storeByte(address uint32, value byte) {
+	for _, hook := range StoreHooks {
+		hook(address, memory[address], value)
+	}
+
+	memory[address] = value
+}
+
+// ResolveAddress gives the segment and offset a memory operand refers to. The
+// default segment is ss for bp-based addressing and ds otherwise, unless the
+// operand carries an override.
+func ResolveAddress(operand Operand, registers Registers) (segment uint16, offset uint16) {
+	segmentName := "ds"
+
+	switch op := operand.(type) {
+	case OperandDirectAddress:
+		offset = op.Address
+		if op.Segment != "" {
+			segmentName = op.Segment
+		}
+
+	case OperandEffectiveAddress:
+		offset = EvalEffectiveAddress(op, registers)
+		if op.Segment != "" {
+			segmentName = op.Segment
+		} else if strings.HasPrefix(op.Base, "bp") {
+			segmentName = "ss"
+		}
+	}
+
+	return uint16(registers[SegmentRegisterIndex(segmentName)]), offset
+}
+
+func SegmentRegisterIndex(name string) RegisterIndex {
+	switch name {
+	case "es":
+		return RI_es
+	case "cs":
+		return RI_cs
+	case "ss":
+		return RI_ss
+	}
+
+	return RI_ds
+}
@@ -0,0 +1,122 @@
+package main
+
+// Pic8259 is the interrupt controller: eight request lines, a mask, and
+// fixed priority with line 0 the most urgent. It is programmed through ports
+// 20h (command) and 21h (data).
+type Pic8259 struct {
+	Base byte // vector of line 0, set by the second initialisation word
+
+	irr, isr, imr byte
+
+	ready    bool // initialised, no interrupts are passed on before
+	init     int  // initialisation word expected next, 0 when running
+	needIcw4 bool // ICW4 follows ICW2/ICW3
+	single   bool // no ICW3, no cascaded controller
+	readIsr  bool // command port reads return in-service instead of requests
+}
+
+func (pic *Pic8259) In(port uint16) byte {
+	if port&1 == 1 {
+		return pic.imr
+	}
+
+	if pic.readIsr {
+		return pic.isr
+	}
+
+	return pic.irr
+}
+
+func (pic *Pic8259) Out(port uint16, value byte) {
+	if port&1 == 0 {
+		switch {
+		case value&0x10 != 0: // ICW1 restarts initialisation
+			pic.ready = false
+			pic.init = 2
+			pic.needIcw4 = value&0x01 != 0
+			pic.single = value&0x02 != 0
+			pic.imr, pic.isr, pic.irr = 0, 0, 0
+			pic.readIsr = false
+
+		case value&0x08 != 0: // OCW3 selects what the command port reads
+			if value&0x02 != 0 {
+				pic.readIsr = value&0x01 != 0
+			}
+
+		default: // OCW2 ends an interrupt
+			switch value & 0xe0 {
+			case 0x20: // non-specific, the highest priority in service
+				for line := range byte(8) {
+					if pic.isr&(1<<line) != 0 {
+						pic.isr &^= 1 << line
+						break
+					}
+				}
+
+			case 0x60: // specific line
+				pic.isr &^= 1 << (value & 7)
+			}
+		}
+
+		return
+	}
+
+	switch pic.init {
+	case 2:
+		pic.Base = value &^ 7
+		pic.init = 3
+		if pic.single {
+			pic.init = 4
+		}
+		if pic.init == 4 && !pic.needIcw4 {
+			pic.init = 0
+		}
+
+	case 3: // cascade wiring, only one controller here
+		pic.init = 4
+		if !pic.needIcw4 {
+			pic.init = 0
+		}
+
+	case 4: // 8086 mode, buffering and auto-EOI are not modelled
+		pic.init = 0
+
+	default: // OCW1 masks lines
+		pic.imr = value
+	}
+
+	pic.ready = pic.init == 0
+}
+
+// Raise requests an interrupt on line.
+func (pic *Pic8259) Raise(line int) {
+	pic.irr |= 1 << line
+}
+
+// Pending reports the highest priority request that is unmasked and more
+// urgent than anything in service.
+func (pic *Pic8259) Pending() (line int, ok bool) {
+	if !pic.ready {
+		return 0, false
+	}
+
+	requests := pic.irr &^ pic.imr
+	for line := range 8 {
+		if pic.isr&(1<<line) != 0 {
+			return 0, false
+		}
+		if requests&(1<<line) != 0 {
+			return line, true
+		}
+	}
+
+	return 0, false
+}
+
+// Acknowledge moves the pending request into service and returns its vector.
+func (pic *Pic8259) Acknowledge(line int) byte {
+	pic.irr &^= 1 << line
+	pic.isr |= 1 << line
+
+	return pic.Base + byte(line)
+}
@@ -0,0 +1,184 @@
+package main
+
+// The timer runs at 1.19318 MHz, a quarter of the 4.77 MHz CPU clock.
+const cyclesPerPitTick = 4
+
+// Pit8253 is the programmable interval timer: three 16-bit down counters
+// at ports 40h-42h and a mode register at 43h.
+type Pit8253 struct {
+	Channels [3]PitChannel
+
+	// Output is called when a channel's output rises, channel 0 drives IRQ0
+	Output func(channel int)
+
+	cycles int // left over from the last tick
+}
+
+type PitChannel struct {
+	Mode   byte
+	Access byte // 1 low byte, 2 high byte, 3 low then high
+	Reload uint16
+
+	count    int  // ticks left in the current period
+	armed    bool // counting, reload has been written
+	fired    bool // mode 0 reached terminal count
+	writeLow bool // next lo/hi write is the low byte
+	readHigh bool // next lo/hi read is the high byte
+
+	latched bool
+	latch   uint16
+}
+
+func (pit *Pit8253) In(port uint16) byte {
+	if port&3 == 3 {
+		return 0xff
+	}
+
+	channel := &pit.Channels[port&3]
+
+	value := channel.Value()
+	if channel.latched {
+		value = channel.latch
+	}
+
+	high := channel.Access == 2
+	if channel.Access == 3 {
+		high = channel.readHigh
+		channel.readHigh = !channel.readHigh
+	}
+
+	// a latch holds until both bytes of it have been read
+	if !channel.readHigh {
+		channel.latched = false
+	}
+
+	if high {
+		return byte(value >> 8)
+	}
+
+	return byte(value)
+}
+
+func (pit *Pit8253) Out(port uint16, value byte) {
+	if port&3 == 3 {
+		index := value >> 6
+		if index == 3 {
+			return
+		}
+
+		channel := &pit.Channels[index]
+
+		access := value >> 4 & 3
+		if access == 0 {
+			channel.latch = channel.Value()
+			channel.latched = true
+			channel.readHigh = false
+			return
+		}
+
+		mode := value >> 1 & 7
+		if mode > 5 {
+			mode -= 4
+		}
+
+		*channel = PitChannel{Mode: mode, Access: access, writeLow: true}
+		return
+	}
+
+	channel := &pit.Channels[port&3]
+
+	switch channel.Access {
+	case 1:
+		channel.Reload = uint16(value)
+	case 2:
+		channel.Reload = uint16(value) << 8
+	case 3:
+		if channel.writeLow {
+			channel.Reload = channel.Reload&0xff00 | uint16(value)
+			channel.writeLow = false
+			return
+		}
+
+		channel.Reload = channel.Reload&0xff | uint16(value)<<8
+		channel.writeLow = true
+	}
+
+	channel.count = channel.period()
+	channel.armed = true
+	channel.fired = false
+}
+
+// Tick counts the channels down by the timer ticks that fit in cycles.
+func (pit *Pit8253) Tick(cycles int) {
+	pit.cycles += cycles
+	ticks := pit.cycles / cyclesPerPitTick
+	pit.cycles %= cyclesPerPitTick
+
+	for i := range pit.Channels {
+		for range pit.Channels[i].advance(ticks) {
+			if pit.Output != nil {
+				pit.Output(i)
+			}
+		}
+	}
+}
+
+// a reload of zero counts the full 65536
+func (channel *PitChannel) period() int {
+	if channel.Reload == 0 {
+		return 0x10000
+	}
+
+	return int(channel.Reload)
+}
+
+// advance moves the counter on and returns how many times the output rose.
+// Modes 0, 1 and 4 go off once at terminal count, the others are periodic.
+func (channel *PitChannel) advance(ticks int) int {
+	if !channel.armed || ticks == 0 {
+		return 0
+	}
+
+	period := channel.period()
+
+	switch channel.Mode {
+	case 0, 1, 4:
+		edges := 0
+		if !channel.fired && ticks >= channel.count {
+			channel.fired = true
+			edges = 1
+		}
+
+		channel.count = ((channel.count-ticks)%0x10000 + 0x10000) % 0x10000
+		return edges
+	}
+
+	if ticks < channel.count {
+		channel.count -= ticks
+		return 0
+	}
+
+	ticks -= channel.count
+	channel.count = period - ticks%period
+
+	return 1 + ticks/period
+}
+
+// Value is what reading the counter returns. In square wave mode the
+// counter runs down twice per period, two at a time.
+func (channel *PitChannel) Value() uint16 {
+	if !channel.armed {
+		return channel.Reload
+	}
+
+	if channel.Mode == 3 {
+		half := channel.period() / 2
+		if channel.count > half {
+			return uint16(2 * (channel.count - half))
+		}
+
+		return uint16(2 * channel.count)
+	}
+
+	return uint16(channel.count)
+}
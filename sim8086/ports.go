@@ -0,0 +1,114 @@
+package main
+
+import "io"
+
+// Device is a peripheral on the I/O bus. The 8086 moves words to 8-bit
+// devices as two byte transfers, so devices only ever see bytes.
+type Device interface {
+	In(port uint16) byte
+	Out(port uint16, value byte)
+}
+
+// Clocked devices keep time with the CPU, they are told how many cycles each
+// instruction took.
+type Clocked interface {
+	Tick(cycles int)
+}
+
+type portRange struct {
+	first, last uint16
+	waits       int
+	device      Device
+}
+
+// PortBus routes in and out to the device registered on a port. Reads from
+// ports nobody answers float high, writes to them are lost.
+type PortBus struct {
+	ranges []portRange
+}
+
+var Ports = &PortBus{}
+
+// Register attaches a device to ports first through last. Every byte
+// transferred to it costs waits extra cycles.
+func (bus *PortBus) Register(first, last uint16, waits int, device Device) {
+	bus.ranges = append(bus.ranges, portRange{first, last, waits, device})
+}
+
+func (bus *PortBus) find(port uint16) *portRange {
+	for i := range bus.ranges {
+		if port >= bus.ranges[i].first && port <= bus.ranges[i].last {
+			return &bus.ranges[i]
+		}
+	}
+
+	return nil
+}
+
+// In reads a byte or word from port, returning it with the wait states spent.
+func (bus *PortBus) In(port uint16, wide bool) (value uint16, waits int) {
+	count := uint16(1)
+	if wide {
+		count = 2
+	}
+
+	for i := range count {
+		data := byte(0xff)
+		if r := bus.find(port + i); r != nil {
+			data = r.device.In(port + i)
+			waits += r.waits
+		}
+
+		value |= uint16(data) << (8 * i)
+	}
+
+	return value, waits
+}
+
+// Out writes a byte or word to port, returning the wait states spent.
+func (bus *PortBus) Out(port uint16, value uint16, wide bool) (waits int) {
+	count := uint16(1)
+	if wide {
+		count = 2
+	}
+
+	for i := range count {
+		if r := bus.find(port + i); r != nil {
+			r.device.Out(port+i, byte(value>>(8*i)))
+			waits += r.waits
+		}
+	}
+
+	return waits
+}
+
+// Tick advances every clocked device.
+func (bus *PortBus) Tick(cycles int) {
+	for _, r := range bus.ranges {
+		if clocked, ok := r.device.(Clocked); ok {
+			clocked.Tick(cycles)
+		}
+	}
+}
+
+// The PC's interrupt controller and timer.
+var Pic = &Pic8259{}
+var Pit = &Pit8253{}
+
+// InstallDevices puts the standard PC devices, the VGA palette and the CGA
+// colour select on the bus at their usual ports, with the serial port
+// transmitting to uart. The PC bus adds a wait state to every I/O transfer.
+func InstallDevices(uart io.Writer) {
+	// timer channel 0 is wired to interrupt request 0
+	Pit.Output = func(channel int) {
+		if channel == 0 {
+			Pic.Raise(0)
+		}
+	}
+
+	Ports.Register(0x20, 0x21, 1, Pic)
+	Ports.Register(0x40, 0x43, 1, Pit)
+	Ports.Register(0x3c7, 0x3c9, 1, Dac)
+	Ports.Register(0x3d9, 0x3d9, 1, Cga)
+	Ports.Register(0x3f8, 0x3ff, 1, NewUart(uart))
+}
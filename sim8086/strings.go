@@ -0,0 +1,77 @@
+package main
+
+// RepeatString runs a string instruction, honouring a rep prefix: cx counts
+// the iterations down, and cmps/scas also stop once zero stops matching the
+// prefix (rep/repe while equal, repne while not). Returns the iteration count.
+func RepeatString(inst *Instruction, registers Registers, memory Memory) int {
+	if inst.Rep == "" {
+		StringStep(inst, registers, memory)
+		return 1
+	}
+
+	repetitions := 0
+	for registers[RI_c] != 0 {
+		StringStep(inst, registers, memory)
+		registers[RI_c]--
+		repetitions++
+
+		if inst.Op == "cmps" || inst.Op == "scas" {
+			zero := GetFlag(registers, RF_zero)
+			if (inst.Rep == "rep" && !zero) || (inst.Rep == "repne" && zero) {
+				break
+			}
+		}
+	}
+
+	return repetitions
+}
+
+// StringStep performs a single iteration, reading from ds:[si] and writing to
+// es:[di], then moves si and di by the element size in the direction set by
+// DF. Only the source segment can be overridden.
+func StringStep(inst *Instruction, registers Registers, memory Memory) {
+	wide := inst.Wide
+
+	source := OperandEffectiveAddress{Base: "si", Wide: wide, Segment: inst.Segment}
+	destination := OperandEffectiveAddress{Base: "di", Wide: wide, Segment: "es"}
+	accumulator := DecodeReg(0, wide)
+
+	delta := int16(1)
+	if wide {
+		delta = 2
+	}
+	if GetFlag(registers, RF_direction) {
+		delta = -delta
+	}
+
+	switch inst.Op {
+	case "movs":
+		value := GetOperandValue(source, registers, memory)
+		SetOperandValue(destination, value, registers, memory)
+		registers[RI_si] += delta
+		registers[RI_di] += delta
+
+	case "cmps":
+		left := GetOperandValue(source, registers, memory)
+		right := GetOperandValue(destination, registers, memory)
+		Sub(left, right, false, wide, registers)
+		registers[RI_si] += delta
+		registers[RI_di] += delta
+
+	case "scas":
+		left := GetOperandValue(accumulator, registers, memory)
+		right := GetOperandValue(destination, registers, memory)
+		Sub(left, right, false, wide, registers)
+		registers[RI_di] += delta
+
+	case "lods":
+		value := GetOperandValue(source, registers, memory)
+		SetOperandValue(accumulator, value, registers, memory)
+		registers[RI_si] += delta
+
+	case "stos":
+		value := GetOperandValue(accumulator, registers, memory)
+		SetOperandValue(destination, value, registers, memory)
+		registers[RI_di] += delta
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// cp437 is how the PC character set looks in Unicode, control codes
+// included since text memory shows them as glyphs.
+const cp437 = "" +
+	" ☺☻♥♦♣♠•◘○◙♂♀♪♫☼►◄↕‼¶§▬↨↑↓→←∟↔▲▼" +
+	" !\"#$%&'()*+,-./0123456789:;<=>?" +
+	"@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_" +
+	"`abcdefghijklmnopqrstuvwxyz{|}~⌂" +
+	"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+var cp437Runes = []rune(cp437)
+
+// the CGA orders its colours blue, green, red; ANSI goes red, green, blue
+var cgaToAnsi = [8]int{0, 4, 2, 6, 1, 5, 3, 7}
+
+// TextScreen shows the 80x25 character and attribute buffer at b800:0000 on
+// an ANSI terminal. Watch it with a store hook to learn when it changes.
+type TextScreen struct {
+	Output io.Writer
+
+	drawn bool // the screen has been drawn over the terminal before
+	dirty bool // text memory changed since the last draw
+}
+
+func (screen *TextScreen) Watch(address uint32, old, value byte) {
+	start := PhysicalAddress(TextSegment, 0)
+	if address >= start && address < start+TextColumns*TextRows*2 && old != value {
+		screen.dirty = true
+	}
+}
+
+// Refresh redraws the screen in place if text memory changed.
+func (screen *TextScreen) Refresh(memory Memory) {
+	if !screen.dirty {
+		return
+	}
+
+	if !screen.drawn {
+		fmt.Fprint(screen.Output, "\x1b[2J")
+		screen.drawn = true
+	}
+
+	fmt.Fprint(screen.Output, "\x1b[H")
+	screen.Draw(memory)
+	screen.dirty = false
+
+	// leave the terminal cursor where the BIOS cursor is
+	row, column := cursor(activePage(memory), memory)
+	fmt.Fprintf(screen.Output, "\x1b[%d;%dH", row+1, column+1)
+}
+
+// Draw writes the 25 rows from the cursor position down, with colours, and
+// resets the colours after.
+func (screen *TextScreen) Draw(memory Memory) {
+	var out strings.Builder
+	last := -1
+
+	for row := range uint16(TextRows) {
+		for column := range uint16(TextColumns) {
+			cell := memory.Load(TextSegment, (row*TextColumns+column)*2, true)
+			char, attribute := byte(cell), int(cell>>8)
+
+			// bright foregrounds use the 90s, the blink bit is shown as a bright background
+			if attribute != last {
+				foreground := 30 + cgaToAnsi[attribute&7]
+				if attribute&0x08 != 0 {
+					foreground += 60
+				}
+
+				background := 40 + cgaToAnsi[attribute>>4&7]
+				if attribute&0x80 != 0 {
+					background += 60
+				}
+
+				fmt.Fprintf(&out, "\x1b[%d;%dm", foreground, background)
+				last = attribute
+			}
+
+			out.WriteRune(cp437Runes[char])
+		}
+
+		out.WriteString("\x1b[0m\n")
+		last = -1
+	}
+
+	io.WriteString(screen.Output, out.String())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextScreenRefresh(t *testing.T) {
+	memory := make(Memory, MemorySize)
+	setVideoMode(3, memory)
+
+	var out strings.Builder
+	screen := &TextScreen{Output: &out}
+
+	screen.Refresh(memory)
+	if out.Len() != 0 {
+		t.Fatalf("unchanged screen drew %q", out.String())
+	}
+
+	// outside text memory, and a store of the same value, are not changes
+	screen.Watch(PhysicalAddress(TextSegment, TextColumns*TextRows*2), 0, 'x')
+	screen.Watch(PhysicalAddress(TextSegment, 0), 0x20, 0x20)
+	screen.Refresh(memory)
+	if out.Len() != 0 {
+		t.Fatalf("screen drew %q without a change", out.String())
+	}
+
+	memory.Store(TextSegment, 0, 0x1f41, true)
+	screen.Watch(PhysicalAddress(TextSegment, 0), 0x20, 'A')
+	setCursor(0, 0, 1, memory)
+	screen.Refresh(memory)
+
+	drawn := out.String()
+	if !strings.HasPrefix(drawn, "\x1b[2J\x1b[H\x1b[97;44mA\x1b[37;40m ") {
+		t.Errorf("first refresh starts %q", drawn[:min(len(drawn), 40)])
+	}
+	if !strings.HasSuffix(drawn, "\x1b[0m\n\x1b[1;2H") {
+		t.Errorf("first refresh ends %q", drawn[max(0, len(drawn)-20):])
+	}
+	if rows := strings.Count(drawn, "\n"); rows != TextRows {
+		t.Errorf("first refresh drew %d rows", rows)
+	}
+
+	// the terminal is only cleared the first time
+	out.Reset()
+	screen.Watch(PhysicalAddress(TextSegment, 2), 0x20, 'B')
+	screen.Refresh(memory)
+	if drawn := out.String(); !strings.HasPrefix(drawn, "\x1b[H") {
+		t.Errorf("second refresh starts %q", drawn[:min(len(drawn), 40)])
+	}
+
+	out.Reset()
+	screen.Refresh(memory)
+	if out.Len() != 0 {
+		t.Errorf("refresh after a refresh drew %q", out.String())
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TraceFormat is how the trace is written: "text", the commented assembly
+// the listings are checked against, or "json", one TraceEvent a line and a
+// TraceEnd to finish.
+var TraceFormat = "text"
+
+// Tracing is the event of the step in progress, nil between steps.
+var Tracing *TraceEvent
+
+// QuietSteps leaves the steps out of the trace but not how the program ended.
+var QuietSteps bool
+
+// TraceEvent is what one step did: the instruction, the operand values it
+// read and everything it changed, including what an interrupt it took did.
+type TraceEvent struct {
+	Event     string           `json:"event"` // always "step"
+	Address   uint32           `json:"address"`
+	CS        uint16           `json:"cs"`
+	IP        uint16           `json:"ip"`
+	Bytes     string           `json:"bytes"`
+	Mnemonic  string           `json:"mnemonic"`
+	Text      string           `json:"text"`
+	Operands  []TraceOperand   `json:"operands,omitempty"`
+	Result    *uint16          `json:"result,omitempty"` // the destination afterwards
+	Fault     string           `json:"fault,omitempty"`
+	Registers []TraceRegister  `json:"registers,omitempty"`
+	Flags     *TraceFlagChange `json:"flags,omitempty"`
+	Memory    []MemoryChange   `json:"memory,omitempty"`
+	Irq       *TraceIrq        `json:"irq,omitempty"`
+	Cycles    int              `json:"cycles"`
+	Total     int              `json:"total"` // cycles since the start
+
+	before      [RI_Count]int16
+	executed    [RI_Count]int16 // registers before any hardware interrupt
+	destination RegisterIndex   // register the destination operand is in, if any
+	shown       uint16          // bits of it the destination operand shows
+	computed    []int16         // flags each time an operation set them
+}
+
+type TraceOperand struct {
+	Operand string `json:"operand"`
+	Value   uint16 `json:"value"`
+}
+
+type TraceRegister struct {
+	Register string `json:"register"`
+	Old      uint16 `json:"old"`
+	New      uint16 `json:"new"`
+}
+
+// TraceFlagChange is the flags set before and after, as letters.
+type TraceFlagChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type TraceIrq struct {
+	Line   int  `json:"line"`
+	Vector byte `json:"vector"`
+}
+
+// BeginTrace starts the event for the instruction about to run.
+func BeginTrace(inst *Instruction, address uint32, registers Registers, memory Memory) *TraceEvent {
+	event := &TraceEvent{
+		Event:       "step",
+		Address:     address,
+		CS:          uint16(registers[RI_cs]),
+		IP:          uint16(registers[RI_ip]),
+		Bytes:       hex.EncodeToString(memory.Fetch(uint16(registers[RI_cs]), uint16(registers[RI_ip]))[:inst.Size]),
+		Mnemonic:    inst.Op,
+		Text:        inst.String(),
+		destination: RI_Count,
+	}
+	copy(event.before[:], registers)
+	event.executed = event.before
+
+	Tracing = event
+
+	return event
+}
+
+// Executed notes the registers once the instruction is done, before the
+// CPU takes any hardware interrupt.
+func (event *TraceEvent) Executed(registers Registers) {
+	copy(event.executed[:], registers)
+}
+
+// End works out the register and flag changes since BeginTrace and stops
+// collecting memory writes.
+func (event *TraceEvent) End(registers Registers) {
+	Tracing = nil
+
+	for idx := RI_a; idx < RI_Count; idx++ {
+		if idx == RI_flags || event.before[idx] == registers[idx] {
+			continue
+		}
+
+		event.Registers = append(event.Registers, TraceRegister{
+			OperandRegister{idx, 0, 2}.String(), uint16(event.before[idx]), uint16(registers[idx]),
+		})
+	}
+
+	if event.before[RI_flags] != registers[RI_flags] {
+		event.Flags = &TraceFlagChange{FlagLetters(event.before[RI_flags]), FlagLetters(registers[RI_flags])}
+	}
+}
+
+// Write puts the event on Trace in TraceFormat. The text form leaves
+// cycles out unless asked.
+func (event *TraceEvent) Write(cycles bool) {
+	if QuietSteps {
+		return
+	}
+
+	if TraceFormat == "json" {
+		line, _ := json.Marshal(event)
+		fmt.Fprintf(Trace, "%s\n", line)
+		return
+	}
+
+	var out strings.Builder
+	fmt.Fprintln(&out, event.Text)
+
+	if event.Fault != "" {
+		fmt.Fprintf(&out, "; %s\n", event.Fault)
+	}
+
+	// every time, even unchanged, and repeated string ops set them over and over
+	for _, flags := range event.computed {
+		fmt.Fprintf(&out, "; Flags: %s\n", FlagLetters(flags))
+	}
+
+	if event.Result != nil {
+		fmt.Fprintf(&out, "; %s 0x%04x->0x%04x\n", event.Operands[0].Operand, event.Operands[0].Value, *event.Result)
+	}
+
+	// registers the instruction changed that the destination doesn't show
+	for idx := RI_a; idx < RI_ip; idx++ {
+		changed := uint16(event.before[idx] ^ event.executed[idx])
+		if idx == event.destination {
+			changed &^= event.shown
+		}
+
+		if changed != 0 {
+			reg := OperandRegister{idx, 0, 2}
+			fmt.Fprintf(&out, "; %s 0x%04x->0x%04x\n", reg, uint16(event.before[idx]), uint16(event.executed[idx]))
+		}
+	}
+
+	if cycles {
+		fmt.Fprintf(&out, "; cycles +%d = %d\n", event.Cycles, event.Total)
+	}
+
+	if event.Irq != nil {
+		fmt.Fprintf(&out, "; irq %d -> int %d\n", event.Irq.Line, event.Irq.Vector)
+	}
+
+	io.WriteString(Trace, out.String())
+}
+
+// TraceEnd is the last event, why the program stopped: "exit" when it ended,
+// with the code it gave DOS, or "fault" when it couldn't go on.
+type TraceEnd struct {
+	Event   string `json:"event"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriteTraceEnd finishes the trace with err, what stopped the program, or
+// nil when it ran off the end of its image. The text form is just a comment.
+func WriteTraceEnd(err error) {
+	if TraceFormat != "json" {
+		if err != nil {
+			fmt.Fprintln(Trace, ";", err)
+		}
+		return
+	}
+
+	end := TraceEnd{Event: "exit"}
+
+	var exit ProgramExit
+	switch {
+	case err == nil:
+		code := 0
+		end.Code = &code
+	case errors.As(err, &exit):
+		code := int(exit.Code)
+		end.Code, end.Message = &code, err.Error()
+	default:
+		end.Event, end.Message = "fault", err.Error()
+	}
+
+	line, _ := json.Marshal(end)
+	fmt.Fprintf(Trace, "%s\n", line)
+}
+
+// TraceOperands notes the values an instruction's operands held.
+func TraceOperands(inst *Instruction, left, right int16) {
+	if Tracing == nil {
+		return
+	}
+
+	for i, value := range []int16{left, right} {
+		if inst.Operands[i] != nil {
+			Tracing.Operands = append(Tracing.Operands, TraceOperand{inst.Operands[i].String(), uint16(value)})
+		}
+	}
+
+	if reg, ok := inst.Operands[0].(OperandRegister); ok {
+		Tracing.destination = reg.Index
+		Tracing.shown = 0xffff
+		if reg.Size == 1 {
+			Tracing.shown = 0xff << (8 * reg.Offset)
+		}
+	}
+}
+
+// TraceResult notes the destination operand's value after the instruction.
+func TraceResult(value int16) {
+	if Tracing != nil {
+		result := uint16(value)
+		Tracing.Result = &result
+	}
+}
+
+// TraceFlags notes flags an operation just computed.
+func TraceFlags(registers Registers) {
+	if Tracing != nil {
+		Tracing.computed = append(Tracing.computed, registers[RI_flags])
+	}
+}
+
+func TraceFault(fault string) {
+	if Tracing != nil {
+		Tracing.Fault = fault
+	}
+}
+
+func TraceInterruptRequest(line int, vector byte) {
+	if Tracing != nil {
+		Tracing.Irq = &TraceIrq{line, vector}
+	}
+}
+
+// TraceStore is the store hook that collects the step's memory writes.
+func TraceStore(address uint32, old, value byte) {
+	if Tracing != nil {
+		Tracing.Memory = append(Tracing.Memory, MemoryChange{address, old, value})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJsonTraceIsOnlyEvents(t *testing.T) {
+	dir := t.TempDir()
+	programs := map[string][]byte{
+		// prints A, exits with code 3
+		"exit.com": {0xb4, 0x02, 0xb2, 0x41, 0xcd, 0x21, 0xb8, 0x03, 0x4c, 0xcd, 0x21},
+		// asks DOS for a function it doesn't have
+		"fault.com": {0xb4, 0xff, 0xcd, 0x21},
+	}
+	for name, program := range programs {
+		if err := os.WriteFile(filepath.Join(dir, name), program, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		end  TraceEnd
+	}{
+		{"listings/exec/listing_0054_draw_rectangle", TraceEnd{Event: "exit"}},
+		{filepath.Join(dir, "exit.com"), TraceEnd{Event: "exit", Message: "program exited with code 3"}},
+		{filepath.Join(dir, "fault.com"), TraceEnd{Event: "fault", Message: "unsupported dos function ffh"}},
+	}
+
+	for _, test := range tests {
+		t.Run(filepath.Base(test.path), func(t *testing.T) {
+			stdout, _ := simulate(t, "-mode", "exec", "-trace", "json", "-screen", "end", "-path", test.path)
+
+			lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+			for i, line := range lines {
+				var event map[string]any
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("line %d isn't JSON: %q", i+1, line)
+				}
+
+				want := "step"
+				if i == len(lines)-1 {
+					want = test.end.Event
+				}
+				if event["event"] != want {
+					t.Errorf("line %d is a %v event, want %s", i+1, event["event"], want)
+				}
+			}
+
+			var end TraceEnd
+			json.Unmarshal([]byte(lines[len(lines)-1]), &end)
+			if end.Message != test.end.Message {
+				t.Errorf("ended with %q, want %q", end.Message, test.end.Message)
+			}
+		})
+	}
+}
+
+func TestJsonTraceSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "steps")
+	// mov bx, 100h; mov dl, 0f0h; add dl, 20h; mov [bx], dl
+	program := []byte{0xbb, 0x00, 0x01, 0xb2, 0xf0, 0x80, 0xc2, 0x20, 0x88, 0x17}
+	if err := os.WriteFile(path, program, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _ := simulate(t, "-mode", "exec", "-trace", "json", "-path", path)
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("%d lines of trace:\n%s", len(lines), stdout)
+	}
+
+	result := uint16(0x10)
+	tests := []TraceEvent{
+		{
+			// a byte register changes the word it is part of, and carries
+			Event: "step", Address: 5, IP: 5, Bytes: "80c220", Mnemonic: "add", Text: "add dl, byte 32",
+			Operands:  []TraceOperand{{"dl", 0xf0}, {"byte 32", 0x20}},
+			Result:    &result,
+			Registers: []TraceRegister{{"dx", 0xf0, 0x10}, {"ip", 5, 8}},
+			Flags:     &TraceFlagChange{"", "C"},
+			Cycles:    4, Total: 12,
+		},
+		{
+			Event: "step", Address: 8, IP: 8, Bytes: "8817", Mnemonic: "mov", Text: "mov [bx+0], dl",
+			Operands:  []TraceOperand{{"[bx+0]", 0}, {"dl", 0x10}},
+			Result:    &result,
+			Registers: []TraceRegister{{"ip", 8, 10}},
+			Memory:    []MemoryChange{{0x100, 0, 0x10}},
+			Cycles:    14, Total: 26,
+		},
+	}
+
+	for i, want := range tests {
+		var got TraceEvent
+		if err := json.Unmarshal([]byte(lines[2+i]), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("step %d is\n%+v\nwant\n%+v", 3+i, got, want)
+		}
+	}
+}
+
+func TestTextTraceLeavesOutConsole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.com")
+	// writes Hi through the BIOS teletype, then exits
+	program := []byte{0xb8, 0x48, 0x0e, 0xcd, 0x10, 0xb0, 0x69, 0xcd, 0x10, 0xcd, 0x20}
+	if err := os.WriteFile(path, program, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := simulate(t, "-mode", "exec", "-path", path)
+	if stderr != "Hi" {
+		t.Errorf("console got %q, want \"Hi\"", stderr)
+	}
+
+	// the program's instructions and the BIOS returning from its handler
+	instructions := map[string]bool{
+		"bits 16":           true,
+		"mov ax, word 3656": true,
+		"int byte 16":       true,
+		"mov al, byte 105":  true,
+		"int byte 32":       true,
+		"iret":              true,
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		if line != "" && !strings.HasPrefix(line, ";") && !instructions[line] {
+			t.Errorf("line %d of the trace is %q", i+1, line)
+		}
+	}
+}
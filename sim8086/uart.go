@@ -0,0 +1,117 @@
+package main
+
+import "io"
+
+// The UART's reference clock divided by 16, the baud rate for a divisor of 1.
+const uartBaseBaud = 115200
+
+// cpuHz is the 4.77 MHz clock of the original PC.
+const cpuHz = 4772727
+
+// Uart16550 is a serial port at 3f8h-3ffh that only transmits. Every byte
+// written goes straight to the output, but the line status keeps reporting
+// the transmitter busy for as long as the byte would take on the wire at the
+// programmed baud rate, so programs that poll it wait realistically.
+type Uart16550 struct {
+	output io.Writer
+
+	divisor uint16
+	ier     byte
+	fcr     byte
+	lcr     byte
+	mcr     byte
+	scratch byte
+
+	busy int // cycles until the transmitter is empty again
+}
+
+func NewUart(output io.Writer) *Uart16550 {
+	return &Uart16550{output: output, divisor: 12} // 9600 baud
+}
+
+func (uart *Uart16550) dlab() bool {
+	return uart.lcr&0x80 != 0
+}
+
+func (uart *Uart16550) In(port uint16) byte {
+	switch port & 7 {
+	case 0:
+		if uart.dlab() {
+			return byte(uart.divisor)
+		}
+		return 0 // nothing is ever received
+	case 1:
+		if uart.dlab() {
+			return byte(uart.divisor >> 8)
+		}
+		return uart.ier
+	case 2: // no interrupt pending, fifo state in the top bits
+		if uart.fcr&1 != 0 {
+			return 0xc1
+		}
+		return 0x01
+	case 3:
+		return uart.lcr
+	case 4:
+		return uart.mcr
+	case 5: // line status: holding register and transmitter empty when idle
+		if uart.busy > 0 {
+			return 0
+		}
+		return 0x60
+	case 6: // modem status: carrier, data set ready and clear to send
+		return 0xb0
+	}
+
+	return uart.scratch
+}
+
+func (uart *Uart16550) Out(port uint16, value byte) {
+	switch port & 7 {
+	case 0:
+		if uart.dlab() {
+			uart.divisor = uart.divisor&0xff00 | uint16(value)
+			return
+		}
+
+		uart.output.Write([]byte{value})
+		uart.busy += uart.byteCycles()
+	case 1:
+		if uart.dlab() {
+			uart.divisor = uart.divisor&0xff | uint16(value)<<8
+			return
+		}
+		uart.ier = value & 0x0f
+	case 2:
+		uart.fcr = value
+	case 3:
+		uart.lcr = value
+	case 4:
+		uart.mcr = value & 0x1f
+	case 7:
+		uart.scratch = value
+	}
+}
+
+func (uart *Uart16550) Tick(cycles int) {
+	uart.busy = max(uart.busy-cycles, 0)
+}
+
+// byteCycles is how long one frame takes: start bit, data bits, parity and
+// stop bits as set in the line control register.
+func (uart *Uart16550) byteCycles() int {
+	bits := 1 + 5 + int(uart.lcr&3) + 1
+	if uart.lcr&0x08 != 0 {
+		bits++
+	}
+	if uart.lcr&0x04 != 0 {
+		bits++
+	}
+
+	divisor := int(uart.divisor)
+	if divisor == 0 {
+		divisor = 0x10000
+	}
+
+	return bits * divisor * cpuHz / uartBaseBaud
+}
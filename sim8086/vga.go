@@ -0,0 +1,103 @@
+package main
+
+// VgaDac is the VGA palette: 256 colours of 6-bit red, green and blue,
+// programmed through a write index at 3c8h, a read index at 3c7h and the
+// data port 3c9h, which takes or gives one component at a time.
+type VgaDac struct {
+	Palette [256][3]byte
+
+	writeIndex, readIndex byte
+	writeStep, readStep   int
+	reading               bool
+}
+
+var Dac = NewVgaDac()
+
+// NewVgaDac starts with the palette the VGA BIOS sets for mode 13h: the 16
+// CGA colours, a grey ramp, then rings of 24 hues at three intensities and
+// three saturations each.
+func NewVgaDac() *VgaDac {
+	dac := &VgaDac{}
+
+	cga := []uint32{
+		0x000000, 0x0000aa, 0x00aa00, 0x00aaaa, 0xaa0000, 0xaa00aa, 0xaa5500, 0xaaaaaa,
+		0x555555, 0x5555ff, 0x55ff55, 0x55ffff, 0xff5555, 0xff55ff, 0xffff55, 0xffffff,
+	}
+	for i, rgb := range cga {
+		dac.Palette[i] = [3]byte{byte(rgb>>16) >> 2, byte(rgb>>8) >> 2, byte(rgb) >> 2}
+	}
+
+	greys := []byte{0, 5, 8, 11, 14, 17, 20, 24, 28, 32, 36, 40, 45, 50, 56, 63}
+	for i, grey := range greys {
+		dac.Palette[16+i] = [3]byte{grey, grey, grey}
+	}
+
+	// levels a hue ring steps through, by intensity then saturation
+	levels := [][5]byte{
+		{0, 16, 31, 47, 63}, {31, 39, 47, 55, 63}, {45, 49, 54, 58, 63},
+		{0, 7, 14, 21, 28}, {14, 17, 21, 24, 28}, {20, 22, 24, 26, 28},
+		{0, 4, 8, 12, 16}, {8, 10, 12, 14, 16}, {11, 12, 13, 15, 16},
+	}
+
+	index := 32
+	for _, level := range levels {
+		// blue to magenta to red to yellow to green to cyan and back
+		ring := [][3]int{
+			{0, 0, 4}, {1, 0, 4}, {2, 0, 4}, {3, 0, 4}, {4, 0, 4}, {4, 0, 3}, {4, 0, 2}, {4, 0, 1},
+			{4, 0, 0}, {4, 1, 0}, {4, 2, 0}, {4, 3, 0}, {4, 4, 0}, {3, 4, 0}, {2, 4, 0}, {1, 4, 0},
+			{0, 4, 0}, {0, 4, 1}, {0, 4, 2}, {0, 4, 3}, {0, 4, 4}, {0, 3, 4}, {0, 2, 4}, {0, 1, 4},
+		}
+
+		for _, step := range ring {
+			dac.Palette[index] = [3]byte{level[step[0]], level[step[1]], level[step[2]]}
+			index++
+		}
+	}
+
+	return dac
+}
+
+func (dac *VgaDac) In(port uint16) byte {
+	switch port {
+	case 0x3c7:
+		if dac.reading {
+			return 3
+		}
+		return 0
+	case 0x3c8:
+		return dac.writeIndex
+	}
+
+	value := dac.Palette[dac.readIndex][dac.readStep]
+	dac.readStep++
+	if dac.readStep == 3 {
+		dac.readStep = 0
+		dac.readIndex++
+	}
+
+	return value
+}
+
+func (dac *VgaDac) Out(port uint16, value byte) {
+	switch port {
+	case 0x3c7:
+		dac.readIndex, dac.readStep, dac.reading = value, 0, true
+	case 0x3c8:
+		dac.writeIndex, dac.writeStep, dac.reading = value, 0, false
+	case 0x3c9:
+		dac.Palette[dac.writeIndex][dac.writeStep] = value & 0x3f
+		dac.writeStep++
+		if dac.writeStep == 3 {
+			dac.writeStep = 0
+			dac.writeIndex++
+		}
+	}
+}
+
+// Color widens a palette entry from 6 to 8 bits a component.
+func (dac *VgaDac) Color(index byte) (r, g, b byte) {
+	widen := func(v byte) byte { return v<<2 | v>>4 }
+	entry := dac.Palette[index]
+
+	return widen(entry[0]), widen(entry[1]), widen(entry[2])
+}